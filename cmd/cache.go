@@ -0,0 +1,151 @@
+package cmd
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+func init() {
+	scoreCmd.AddCommand(cacheCmd)
+	cacheCmd.AddCommand(cacheStatsCmd)
+	cacheCmd.AddCommand(cachePruneCmd)
+	cacheCmd.AddCommand(cacheClearCmd)
+
+	cachePruneCmd.Flags().DurationVar(&olderThan, "olderThan", 0, "remove entries older than this. (default is the cacheTtl config value)")
+}
+
+var (
+	olderThan time.Duration
+
+	cacheCmd = &cobra.Command{
+		Use:   "cache",
+		Short: "Inspect and manage the LLM response cache.",
+		Long:  "Inspect and manage the on-disk cache of LLM responses. (default location is $HOME/.score/cache)",
+	}
+
+	cacheStatsCmd = &cobra.Command{
+		Use:   "stats",
+		Short: "Show cache size and entry counts.",
+		Long:  "Show the number of cached responses, their size on disk and a breakdown per model.",
+		Args:  cobra.NoArgs,
+		Run:   onCacheStats,
+	}
+
+	cachePruneCmd = &cobra.Command{
+		Use:   "prune",
+		Short: "Remove expired and unreadable cache entries.",
+		Long:  "Remove cache entries older than --olderThan (or the cacheTtl config value) along with any unreadable entries.",
+		Args:  cobra.NoArgs,
+		Run:   onCachePrune,
+	}
+
+	cacheClearCmd = &cobra.Command{
+		Use:   "clear",
+		Short: "Remove every cache entry.",
+		Long:  "Remove every response stored in the cache directory, leaving any other file in it alone.",
+		Args:  cobra.NoArgs,
+		Run:   onCacheClear,
+	}
+)
+
+func onCacheStats(cmd *cobra.Command, args []string) {
+	dir := getCacheDir()
+
+	var entries, unreadable int
+	var size int64
+	var oldest, newest time.Time
+	perModel := make(map[string]int)
+
+	err := walkCache(dir, func(path string, info fs.FileInfo) error {
+		size += info.Size()
+
+		entry, err := readCacheEntry(path)
+		if err != nil {
+			unreadable++
+			return nil
+		}
+
+		entries++
+		perModel[fmt.Sprintf("%s (%s)", entry.Model, entry.Provider)]++
+		if oldest.IsZero() || entry.StoredAt.Before(oldest) {
+			oldest = entry.StoredAt
+		}
+		if entry.StoredAt.After(newest) {
+			newest = entry.StoredAt
+		}
+		return nil
+	})
+	cobra.CheckErr(err)
+
+	fmt.Printf("Cache directory: %s\n\n", dir)
+	fmt.Printf("Entries: %d\n", entries)
+	fmt.Printf("Unreadable: %d\n", unreadable)
+	fmt.Printf("Size: %.2f MB\n", float64(size)/(1024*1024))
+	if entries > 0 {
+		fmt.Printf("Oldest: %s\n", oldest.Format("01-02-2006, 15:04:05"))
+		fmt.Printf("Newest: %s\n", newest.Format("01-02-2006, 15:04:05"))
+
+		models := make([]string, 0, len(perModel))
+		for model := range perModel {
+			models = append(models, model)
+		}
+		sort.Strings(models)
+
+		fmt.Print("\nEntries per model: \n\n")
+		for _, model := range models {
+			fmt.Printf("\t%s: %d\n", model, perModel[model])
+		}
+	}
+}
+
+func onCachePrune(cmd *cobra.Command, args []string) {
+	ttl := olderThan
+	if ttl == 0 {
+		ttl = viper.GetDuration("cacheTtl")
+	}
+
+	var removed int
+	err := walkCache(getCacheDir(), func(path string, info fs.FileInfo) error {
+		entry, err := readCacheEntry(path)
+		if err == nil && (ttl == 0 || time.Since(entry.StoredAt) <= ttl) {
+			return nil
+		}
+
+		if err := os.Remove(path); err != nil {
+			return err
+		}
+		removed++
+		return nil
+	})
+	cobra.CheckErr(err)
+
+	if ttl == 0 {
+		fmt.Printf("Removed %d unreadable entries. (no --olderThan or cacheTtl set)\n", removed)
+		return
+	}
+	fmt.Printf("Removed %d entries older than %s or unreadable.\n", removed, ttl)
+}
+
+func onCacheClear(cmd *cobra.Command, args []string) {
+	dir := getCacheDir()
+
+	// only cache entries are removed, in case cacheDir holds anything else
+	var removed int
+	err := walkCache(dir, func(path string, info fs.FileInfo) error {
+		if err := os.Remove(path); err != nil {
+			return err
+		}
+		removed++
+		return nil
+	})
+	cobra.CheckErr(err)
+	cobra.CheckErr(removeEmptyShards(dir))
+
+	fmt.Printf("Cleared %d entries from the cache at %s\n", removed, dir)
+}
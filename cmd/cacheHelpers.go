@@ -0,0 +1,201 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+// cacheEntry is stored as <cacheDir>/<hash[:2]>/<hash>.json.
+type cacheEntry struct {
+	Hash     string             `json:"hash"`
+	Provider string             `json:"provider"`
+	Model    string             `json:"model"`
+	StoredAt time.Time          `json:"storedAt"`
+	Response CompletionResponse `json:"response"`
+}
+
+type responseCache struct {
+	dir string
+	ttl time.Duration
+}
+
+// cachingProvider serves responses for previously seen requests from disk
+// and stores every new successful response.
+type cachingProvider struct {
+	Provider
+	cache *responseCache
+}
+
+func getCacheDir() string {
+	dir := viper.GetString("cacheDir")
+	if dir == "" {
+		dir = "$HOME/.score/cache"
+	}
+	return os.ExpandEnv(dir)
+}
+
+func newResponseCache(ttl time.Duration) *responseCache {
+	return &responseCache{dir: getCacheDir(), ttl: ttl}
+}
+
+func (c *responseCache) path(hash string) string {
+	return filepath.Join(c.dir, hash[:2], hash+".json")
+}
+
+func (c *responseCache) get(hash string) (*CompletionResponse, bool) {
+	entry, err := readCacheEntry(c.path(hash))
+	if err != nil {
+		return nil, false
+	}
+
+	if c.ttl > 0 && time.Since(entry.StoredAt) > c.ttl {
+		return nil, false
+	}
+
+	return &entry.Response, true
+}
+
+func (c *responseCache) put(entry cacheEntry) error {
+	path := c.path(entry.Hash)
+	if err := os.MkdirAll(filepath.Dir(path), os.ModePerm); err != nil {
+		return err
+	}
+
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+
+	// write to a temporary file first so concurrent readers never see a
+	// partially written entry
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), path)
+}
+
+func readCacheEntry(path string) (*cacheEntry, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var entry cacheEntry
+	if err := json.Unmarshal(data, &entry); err != nil {
+		return nil, err
+	}
+
+	return &entry, nil
+}
+
+var (
+	cacheShardPattern = regexp.MustCompile(`^[0-9a-f]{2}$`)
+	cacheEntryPattern = regexp.MustCompile(`^[0-9a-f]{64}\.json$`)
+)
+
+// walkCache calls fn for every entry file in the cache directory, those named
+// <hash[:2]>/<hash>.json, leaving any other file alone. A missing cache
+// directory is treated as empty.
+func walkCache(dir string, fn func(path string, info fs.FileInfo) error) error {
+	err := filepath.Walk(dir, func(path string, info fs.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if path == dir {
+			return nil
+		}
+
+		shard := filepath.Base(filepath.Dir(path))
+		if info.IsDir() {
+			if filepath.Dir(path) != dir || !cacheShardPattern.MatchString(info.Name()) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if filepath.Dir(filepath.Dir(path)) != dir || !cacheEntryPattern.MatchString(info.Name()) || !strings.HasPrefix(info.Name(), shard) {
+			return nil
+		}
+		return fn(path, info)
+	})
+
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	return err
+}
+
+// removeEmptyShards removes the shard directories of the cache directory that
+// no longer hold any file.
+func removeEmptyShards(dir string) error {
+	shards, err := os.ReadDir(dir)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	for _, shard := range shards {
+		if !shard.IsDir() || !cacheShardPattern.MatchString(shard.Name()) {
+			continue
+		}
+		path := filepath.Join(dir, shard.Name())
+		if files, err := os.ReadDir(path); err == nil && len(files) == 0 {
+			if err := os.Remove(path); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (p *cachingProvider) Settings() map[string]interface{} {
+	return providerSettings(p.Provider)
+}
+
+func (p *cachingProvider) Complete(ctx context.Context, req CompletionRequest) (*CompletionResponse, error) {
+	hash := requestHash(p.Name(), p.Settings(), req)
+	if resp, ok := p.cache.get(hash); ok {
+		return resp, nil
+	}
+
+	resp, err := p.Provider.Complete(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+
+	// a failed write only costs a future cache miss
+	err = p.cache.put(cacheEntry{
+		Hash:     hash,
+		Provider: p.Name(),
+		Model:    p.Model(),
+		StoredAt: time.Now(),
+		Response: *resp,
+	})
+	if err != nil && viper.GetBool("verbose") {
+		fmt.Printf("\nCache write failed: %s", err)
+	}
+
+	return resp, nil
+}
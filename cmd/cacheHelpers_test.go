@@ -0,0 +1,183 @@
+package cmd
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+func testHash(s string) string {
+	sum := sha256.Sum256([]byte(s))
+	return hex.EncodeToString(sum[:])
+}
+
+// putEntry stores a response as if it was stored the given time ago and returns its hash.
+func putEntry(t *testing.T, c *responseCache, content string, age time.Duration) string {
+	t.Helper()
+	hash := testHash(content)
+	err := c.put(cacheEntry{
+		Hash:     hash,
+		Provider: "mock",
+		Model:    "mock:always-true",
+		StoredAt: time.Now().Add(-age),
+		Response: CompletionResponse{Content: content},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return hash
+}
+
+func writeFile(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestResponseCache(t *testing.T) {
+	c := &responseCache{dir: t.TempDir(), ttl: time.Hour}
+
+	fresh := putEntry(t, c, "fresh", time.Minute)
+	stale := putEntry(t, c, "stale", 2*time.Hour)
+
+	if resp, ok := c.get(fresh); !ok || resp.Content != "fresh" {
+		t.Errorf("get(fresh) = %v, %v, want the stored response", resp, ok)
+	}
+	if _, ok := c.get(stale); ok {
+		t.Error("get(stale) hit an entry older than the ttl")
+	}
+	if _, ok := c.get(testHash("missing")); ok {
+		t.Error("get(missing) hit")
+	}
+
+	c.ttl = 0
+	if _, ok := c.get(stale); !ok {
+		t.Error("get(stale) missed without a ttl")
+	}
+
+	if _, err := os.Stat(c.path(fresh)); err != nil {
+		t.Errorf("entry not stored at %s: %v", c.path(fresh), err)
+	}
+}
+
+func TestWalkCache(t *testing.T) {
+	dir := t.TempDir()
+	c := &responseCache{dir: dir}
+	hash := putEntry(t, c, "entry", 0)
+
+	other := testHash("other")
+	writeFile(t, filepath.Join(dir, "README.md"), "not an entry")
+	writeFile(t, filepath.Join(dir, hash[:2], "notes.json"), "{}")
+	writeFile(t, filepath.Join(dir, hash[:2], other+".json"), "{}")
+	writeFile(t, filepath.Join(dir, "backup", other[:2], other+".json"), "{}")
+	writeFile(t, filepath.Join(dir, other[:2], other+".json.tmp"), "{}")
+
+	var found []string
+	err := walkCache(dir, func(path string, info fs.FileInfo) error {
+		rel, _ := filepath.Rel(dir, path)
+		found = append(found, rel)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := filepath.Join(hash[:2], hash+".json")
+	if len(found) != 1 || found[0] != want {
+		t.Errorf("walkCache found %v, want only %s", found, want)
+	}
+
+	if err := walkCache(filepath.Join(dir, "missing"), func(string, fs.FileInfo) error { return nil }); err != nil {
+		t.Errorf("walkCache of a missing directory: %v", err)
+	}
+}
+
+// cacheFiles lists the files below dir.
+func cacheFiles(t *testing.T, dir string) []string {
+	t.Helper()
+	var files []string
+	err := filepath.Walk(dir, func(path string, info fs.FileInfo, err error) error {
+		if err != nil || info.IsDir() {
+			return err
+		}
+		rel, _ := filepath.Rel(dir, path)
+		files = append(files, rel)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sort.Strings(files)
+	return files
+}
+
+func TestCachePrune(t *testing.T) {
+	dir := t.TempDir()
+	viper.Reset()
+	defer viper.Reset()
+	viper.Set("cacheDir", dir)
+	viper.Set("cacheTtl", time.Hour)
+
+	c := &responseCache{dir: dir}
+	fresh := putEntry(t, c, "fresh", time.Minute)
+	putEntry(t, c, "stale", 2*time.Hour)
+	corrupt := testHash("corrupt")
+	writeFile(t, c.path(corrupt), "{")
+	writeFile(t, filepath.Join(dir, "README.md"), "not an entry")
+
+	onCachePrune(cachePruneCmd, nil)
+
+	want := []string{"README.md", filepath.Join(fresh[:2], fresh+".json")}
+	if got := cacheFiles(t, dir); !reflect.DeepEqual(got, want) {
+		t.Errorf("after prune: %v, want %v", got, want)
+	}
+
+	// --olderThan takes precedence over cacheTtl
+	olderThan = time.Second
+	defer func() { olderThan = 0 }()
+	onCachePrune(cachePruneCmd, nil)
+
+	if got := cacheFiles(t, dir); !reflect.DeepEqual(got, []string{"README.md"}) {
+		t.Errorf("after prune with --olderThan: %v, want only README.md", got)
+	}
+}
+
+func TestCacheClear(t *testing.T) {
+	dir := t.TempDir()
+	viper.Reset()
+	defer viper.Reset()
+	viper.Set("cacheDir", dir)
+
+	c := &responseCache{dir: dir}
+	putEntry(t, c, "one", 0)
+	putEntry(t, c, "two", 0)
+	kept := testHash("kept")
+	writeFile(t, filepath.Join(dir, kept[:2], "notes.txt"), "not an entry")
+
+	onCacheClear(cacheClearCmd, nil)
+
+	want := []string{filepath.Join(kept[:2], "notes.txt")}
+	if got := cacheFiles(t, dir); !reflect.DeepEqual(got, want) {
+		t.Errorf("after clear: %v, want %v", got, want)
+	}
+
+	shards, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(shards) != 1 || shards[0].Name() != kept[:2] {
+		t.Errorf("after clear the cache holds %v, want only the %s shard", shards, kept[:2])
+	}
+}
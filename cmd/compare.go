@@ -0,0 +1,92 @@
+package cmd
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+
+	"github.com/spf13/cobra"
+)
+
+func init() {
+	scoreCmd.AddCommand(compareCmd)
+}
+
+var compareCmd = &cobra.Command{
+	Use:   "compare <export-a.json> <export-b.json>",
+	Short: "Test whether two runs differ significantly.",
+	Long: "Compare two json exports (see run --export) of the same dataset, e.g. runs of two prompts, with McNemar's exact test. " +
+		"Results are paired by dataset row. Models present in both exports are compared with each other; " +
+		"if each export holds a single model they are compared regardless of name.",
+	Args: cobra.ExactArgs(2),
+	Run:  onCompare,
+}
+
+func onCompare(cmd *cobra.Command, args []string) {
+	a, err := exportCorrectness(args[0])
+	cobra.CheckErr(err)
+	b, err := exportCorrectness(args[1])
+	cobra.CheckErr(err)
+
+	type pair struct{ a, b string }
+	var pairs []pair
+	if len(a) == 1 && len(b) == 1 {
+		for llmA := range a {
+			for llmB := range b {
+				pairs = append(pairs, pair{llmA, llmB})
+			}
+		}
+	} else {
+		for llm := range a {
+			if _, ok := b[llm]; ok {
+				pairs = append(pairs, pair{llm, llm})
+			}
+		}
+		sort.Slice(pairs, func(i, j int) bool { return pairs[i].a < pairs[j].a })
+	}
+
+	if len(pairs) == 0 {
+		cobra.CheckErr(fmt.Errorf("%s and %s have no models in common", args[0], args[1]))
+	}
+
+	fmt.Print("\nMcNemar's exact test:\n\n")
+	for _, p := range pairs {
+		nameA := filepath.Base(args[0]) + ":" + p.a
+		nameB := filepath.Base(args[1]) + ":" + p.b
+
+		fmt.Printf("%s: %.2f%%\n", nameA, correctShare(a[p.a]))
+		fmt.Printf("%s: %.2f%%\n", nameB, correctShare(b[p.b]))
+		fmt.Printf("%s\n\n", mcnemar(nameA, nameB, a[p.a], b[p.b]))
+	}
+}
+
+// exportCorrectness reads whether each model was correct on each row.
+func exportCorrectness(path string) (map[string]map[int]bool, error) {
+	report, err := ReadExport(path)
+	if err != nil {
+		return nil, err
+	}
+
+	correct := make(map[string]map[int]bool)
+	for _, result := range report.Results {
+		if correct[result.LLM] == nil {
+			correct[result.LLM] = make(map[int]bool)
+		}
+		if _, ok := correct[result.LLM][result.Row]; ok {
+			return nil, fmt.Errorf("%s has more than one result for row %d of %s, re-run it to record row numbers", path, result.Row, result.LLM)
+		}
+		correct[result.LLM][result.Row] = result.Correct
+	}
+
+	return correct, nil
+}
+
+func correctShare(correct map[int]bool) float64 {
+	n := 0
+	for _, ok := range correct {
+		if ok {
+			n++
+		}
+	}
+	return Round(float64(n)/float64(len(correct))*100, 0.05)
+}
@@ -0,0 +1,497 @@
+package cmd
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/spf13/viper"
+)
+
+// datasetRecord is a dataset row as named fields, with its row number in the
+// file.
+type datasetRecord struct {
+	row    int
+	fields map[string]string
+}
+
+// datasetSchema maps the columns of a csv dataset to the fields of its data
+// entries, so columns are read by header instead of by position. It is the
+// schema section of the config, or a <dataset>.schema.yaml file next to the
+// dataset:
+//
+//	schema:
+//	  id: case_id
+//	  label: verdict
+//	  tags: labels
+//	  inputs: ['diff=diffDelta', 'title']
+//	  base64: ['diff']
+//	  delimiter: ';'
+//	  quote: "'"
+//
+// The id, label and tags columns become the id, passed and tags fields.
+// Inputs are the other columns kept, renamed with column=field, and default
+// to every column under its header name. The first row is the header and
+// every column the schema names must be in it.
+type datasetSchema struct {
+	ID         string   `mapstructure:"id"`
+	Label      string   `mapstructure:"label"`
+	Tags       string   `mapstructure:"tags"`
+	Inputs     []string `mapstructure:"inputs"`
+	Base64     []string `mapstructure:"base64"`
+	Delimiter  string   `mapstructure:"delimiter"`
+	Quote      string   `mapstructure:"quote"`
+	Comment    string   `mapstructure:"comment"`
+	LazyQuotes bool     `mapstructure:"lazyQuotes"`
+}
+
+// quoteless stands in for the quote character when quoting is turned off.
+const quoteless = '\uFFFF'
+
+// dataFormat is the --dataFormat of a dataset, or else the one its extension
+// implies: jsonl for .jsonl and .ndjson files and csv otherwise. A .gz
+// extension is looked past, so data.jsonl.gz is jsonl.
+func dataFormat(path string) string {
+	if format := viper.GetString("dataFormat"); format != "" {
+		return strings.ToLower(format)
+	}
+
+	switch strings.ToLower(filepath.Ext(trimGzip(path))) {
+	case ".jsonl", ".ndjson":
+		return "jsonl"
+	}
+	return "csv"
+}
+
+// datasetBase is the path of a dataset without its extensions, e.g. data for
+// data.csv.gz.
+func datasetBase(path string) string {
+	path = trimGzip(path)
+	return strings.TrimSuffix(path, filepath.Ext(path))
+}
+
+func trimGzip(path string) string {
+	if strings.EqualFold(filepath.Ext(path), ".gz") {
+		return path[:len(path)-len(".gz")]
+	}
+	return path
+}
+
+// datasetFile is an open dataset, decompressed when it is gzipped.
+type datasetFile struct {
+	io.Reader
+	file *os.File
+	gzip *gzip.Reader
+}
+
+// openDataset opens a dataset for streaming. Gzipped files are recognized by
+// their content, whatever their extension.
+func openDataset(path string) (*datasetFile, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+
+	buffered := bufio.NewReader(f)
+	magic, _ := buffered.Peek(2)
+	if !bytes.Equal(magic, []byte{0x1f, 0x8b}) {
+		return &datasetFile{Reader: buffered, file: f}, nil
+	}
+
+	gz, err := gzip.NewReader(buffered)
+	if err != nil {
+		f.Close()
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return &datasetFile{Reader: gz, file: f, gzip: gz}, nil
+}
+
+func (d *datasetFile) Close() error {
+	if d.gzip != nil {
+		d.gzip.Close()
+	}
+	return d.file.Close()
+}
+
+// loadSchema returns the schema of a csv dataset, or nil when it has none.
+// A sidecar file holds what would go under the schema section.
+func loadSchema(path string) (*datasetSchema, error) {
+	var schema datasetSchema
+
+	sidecar := datasetBase(path) + ".schema.yaml"
+	if _, err := os.Stat(sidecar); err == nil {
+		v := viper.New()
+		v.SetConfigFile(sidecar)
+		if err := v.ReadInConfig(); err != nil {
+			return nil, fmt.Errorf("schema: %w", err)
+		}
+		if err := v.Unmarshal(&schema); err != nil {
+			return nil, fmt.Errorf("schema: %s: %w", sidecar, err)
+		}
+		return &schema, nil
+	}
+
+	if !viper.IsSet("schema") {
+		return nil, nil
+	}
+	if err := viper.UnmarshalKey("schema", &schema); err != nil {
+		return nil, fmt.Errorf("schema: %w", err)
+	}
+	return &schema, nil
+}
+
+// scanSchemaCSV streams the rows of a csv dataset by its schema.
+func scanSchemaCSV(path string, schema *datasetSchema, fn func(datasetRecord) error) error {
+	f, err := openDataset(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	reader, swap, err := newSchemaCSVReader(f, schema)
+	if err != nil {
+		return err
+	}
+
+	var columns *schemaColumns
+	for row := 0; ; row++ {
+		values, err := reader.Read()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+
+		if columns == nil {
+			if columns, err = newSchemaColumns(path, schema, values, swap); err != nil {
+				return err
+			}
+			continue
+		}
+
+		record, err := columns.record(row, values)
+		if err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+		if err := fn(record); err != nil {
+			return err
+		}
+	}
+}
+
+// newSchemaCSVReader reads csv with the schema's delimiter and quoting. Fields
+// it returns must be passed through swap.
+func newSchemaCSVReader(r io.Reader, schema *datasetSchema) (*csv.Reader, func(string) string, error) {
+	// encoding/csv only quotes with ", so the schema's quote character and "
+	// trade places while parsing
+	quote := '"'
+	switch {
+	case schema.Quote == "none":
+		quote = quoteless
+	case schema.Quote != "":
+		quote = []rune(schema.Quote)[0]
+		if len([]rune(schema.Quote)) != 1 {
+			return nil, nil, fmt.Errorf("schema: quote must be a single character or none, not %q", schema.Quote)
+		}
+	}
+	swap := func(s string) string {
+		if quote == '"' {
+			return s
+		}
+		return strings.Map(func(r rune) rune {
+			switch r {
+			case quote:
+				return '"'
+			case '"':
+				return quote
+			}
+			return r
+		}, s)
+	}
+
+	if quote != '"' {
+		r = &runeSwapReader{r: bufio.NewReader(r), a: quote, b: '"'}
+	}
+
+	reader := csv.NewReader(r)
+	reader.LazyQuotes = schema.LazyQuotes
+	if schema.Delimiter != "" {
+		if len([]rune(schema.Delimiter)) != 1 {
+			return nil, nil, fmt.Errorf("schema: delimiter must be a single character, not %q", schema.Delimiter)
+		}
+		reader.Comma = []rune(schema.Delimiter)[0]
+	}
+	if schema.Comment != "" {
+		reader.Comment = []rune(schema.Comment)[0]
+	}
+
+	return reader, swap, nil
+}
+
+// runeSwapReader trades two runes for each other as it reads.
+type runeSwapReader struct {
+	r       *bufio.Reader
+	a, b    rune
+	pending []byte
+}
+
+func (s *runeSwapReader) Read(p []byte) (int, error) {
+	n := 0
+	for n < len(p) {
+		if len(s.pending) == 0 {
+			r, _, err := s.r.ReadRune()
+			if err != nil {
+				if n > 0 {
+					return n, nil
+				}
+				return 0, err
+			}
+			switch r {
+			case s.a:
+				r = s.b
+			case s.b:
+				r = s.a
+			}
+			s.pending = utf8.AppendRune(s.pending[:0], r)
+		}
+
+		copied := copy(p[n:], s.pending)
+		s.pending = s.pending[copied:]
+		n += copied
+	}
+	return n, nil
+}
+
+// schemaColumns maps the columns of a csv header to fields by a schema.
+type schemaColumns struct {
+	header  []string
+	fields  map[int]string
+	encoded map[int]bool
+	swap    func(string) string
+}
+
+func newSchemaColumns(path string, schema *datasetSchema, header []string, swap func(string) string) (*schemaColumns, error) {
+	c := schemaColumns{
+		header:  make([]string, len(header)),
+		fields:  make(map[int]string),
+		encoded: make(map[int]bool),
+		swap:    swap,
+	}
+
+	columns := make(map[string]int)
+	for i, name := range header {
+		c.header[i] = swap(name)
+		columns[c.header[i]] = i
+	}
+
+	mapColumn := func(column, field string) error {
+		i, ok := columns[column]
+		if !ok {
+			return fmt.Errorf("schema: column %q is not in the header of %s", column, path)
+		}
+		c.fields[i] = field
+		return nil
+	}
+
+	if len(schema.Inputs) == 0 {
+		for name, i := range columns {
+			c.fields[i] = name
+		}
+	}
+	for _, input := range schema.Inputs {
+		column, field, ok := strings.Cut(input, "=")
+		if !ok {
+			field = column
+		}
+		if err := mapColumn(column, field); err != nil {
+			return nil, err
+		}
+	}
+	for column, field := range map[string]string{schema.ID: "id", schema.Label: "passed", schema.Tags: "tags"} {
+		if column == "" {
+			continue
+		}
+		if err := mapColumn(column, field); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, column := range schema.Base64 {
+		i, ok := columns[column]
+		if !ok {
+			return nil, fmt.Errorf("schema: base64 column %q is not in the header of %s", column, path)
+		}
+		c.encoded[i] = true
+	}
+
+	return &c, nil
+}
+
+// record maps the values of a csv row to named fields.
+func (c *schemaColumns) record(row int, values []string) (datasetRecord, error) {
+	record := datasetRecord{row: row, fields: make(map[string]string)}
+	for i, value := range values {
+		field, ok := c.fields[i]
+		if !ok {
+			continue
+		}
+
+		value = c.swap(value)
+		if c.encoded[i] {
+			decoded, err := Base64Decode(value)
+			if err != nil {
+				return record, fmt.Errorf("row %d: column %s is not valid base64: %w", row, c.header[i], err)
+			}
+			value = decoded
+		}
+		record.fields[field] = value
+	}
+	return record, nil
+}
+
+// scanRecords streams the rows of a jsonl dataset, or a csv dataset with a
+// schema, as named fields.
+func scanRecords(path string, schema *datasetSchema, fn func(datasetRecord) error) error {
+	switch format := dataFormat(path); format {
+	case "csv":
+		return scanSchemaCSV(path, schema, fn)
+	case "jsonl":
+		return scanJSONL(path, fn)
+	default:
+		return fmt.Errorf("unknown --dataFormat %q", format)
+	}
+}
+
+// scanCSV streams the rows of a csv dataset without a schema, numbered from 0
+// with the header.
+func scanCSV(path string, fn func(row int, record []string) error) error {
+	f, err := openDataset(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	reader := csv.NewReader(f)
+	for row := 0; ; row++ {
+		record, err := reader.Read()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+		if err := fn(row, record); err != nil {
+			return err
+		}
+	}
+}
+
+// scanJSONL streams a dataset with one JSON object per line. Blank lines are
+// skipped and rows are numbered by line.
+func scanJSONL(path string, fn func(datasetRecord) error) error {
+	f, err := openDataset(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	scanner := newJSONLScanner(f)
+	for line := 1; scanner.Scan(); line++ {
+		text := bytes.TrimSpace(scanner.Bytes())
+		if len(text) == 0 {
+			continue
+		}
+
+		fields, err := parseJSONRecord(text)
+		if err != nil {
+			return fmt.Errorf("%s:%d: %w", path, line, err)
+		}
+		if err := fn(datasetRecord{row: line, fields: fields}); err != nil {
+			return err
+		}
+	}
+
+	return scanner.Err()
+}
+
+// newJSONLScanner splits jsonl by line, allowing lines of up to 64MB.
+func newJSONLScanner(r io.Reader) *bufio.Scanner {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 64*1024*1024)
+	return scanner
+}
+
+// parseJSONRecord flattens a JSON object into named fields. Nested objects
+// are kept as JSON and their members are also added under dotted names, so
+// {"metadata": {"source": "cve"}} gives metadata and metadata.source. Arrays
+// of plain values, such as tags, are joined with commas.
+func parseJSONRecord(text []byte) (map[string]string, error) {
+	decoder := json.NewDecoder(bytes.NewReader(text))
+	decoder.UseNumber()
+
+	var object map[string]interface{}
+	if err := decoder.Decode(&object); err != nil {
+		return nil, fmt.Errorf("invalid JSON object: %w", err)
+	}
+	if object == nil {
+		return nil, fmt.Errorf("expected a JSON object")
+	}
+	if decoder.More() {
+		return nil, fmt.Errorf("unexpected data after the JSON object")
+	}
+
+	fields := make(map[string]string)
+	for name, value := range object {
+		flattenJSON(name, value, fields)
+	}
+	return fields, nil
+}
+
+func flattenJSON(name string, value interface{}, fields map[string]string) {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		fields[name] = jsonText(v)
+		for key, member := range v {
+			flattenJSON(name+"."+key, member, fields)
+		}
+	case []interface{}:
+		values := make([]string, 0, len(v))
+		for _, item := range v {
+			switch item.(type) {
+			case map[string]interface{}, []interface{}:
+				fields[name] = jsonText(v)
+				return
+			}
+			values = append(values, jsonText(item))
+		}
+		fields[name] = strings.Join(values, ",")
+	default:
+		fields[name] = jsonText(v)
+	}
+}
+
+// jsonText is a JSON value as a field: strings as they are, null as empty and
+// anything else as JSON.
+func jsonText(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	}
+
+	data, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Sprint(value)
+	}
+	return string(data)
+}
@@ -0,0 +1,320 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+// testFramework is how the exec grader runs tests: the file the code under
+// test is written to, the command run next to it, and scaffolding written
+// when the test files do not provide it.
+type testFramework struct {
+	file     string
+	command  []string
+	scaffold map[string]string
+}
+
+var testFrameworks = map[string]testFramework{
+	"go": {
+		file:     "main.go",
+		command:  []string{"go", "test", "./..."},
+		scaffold: map[string]string{"go.mod": "module sandbox\n\ngo 1.21\n"},
+	},
+	"pytest": {
+		file:    "main.py",
+		command: []string{"python3", "-m", "pytest", "-q"},
+	},
+	"shell": {
+		file:    "main.sh",
+		command: []string{"sh", "test.sh"},
+	},
+}
+
+const execOutputLimit = 2000
+
+var (
+	codeBlock   = regexp.MustCompile("(?s)```[^\n]*\n(.*?)\n```")
+	unifiedDiff = regexp.MustCompile(`(?m)^@@ -[0-9]`)
+)
+
+// execGrader patches the code of a pseudo data entry in a scratch directory
+// and runs a framework's tests against it, passing when they exit with 0:
+//
+//	grader:
+//	  type: exec
+//	  exec:
+//	    framework: go
+//	    patch: response
+//	    tests: ./tests/sql-injection
+//	    timeout: 30s
+//
+// The external column is written to the framework's file and the patch, the
+// model's response by default or the dataset's patch column with patch:
+// dataset, is applied on top. Patches may be unified diffs or the complete
+// patched code, optionally in a markdown code block. The files at
+// grader.exec.tests, or --tests, are copied next to the code. With patch:
+// dataset the test result is compared to the row's passed label, so a
+// rejected patch whose tests fail counts as correct.
+//
+// Commands run with a timeout, a scratch working directory and only the
+// environment variables in grader.exec.env. This keeps runs independent but
+// is not a security boundary, so only grade code you would run yourself.
+type execGrader struct {
+	framework string
+	file      string
+	command   []string
+	scaffold  map[string]string
+	dataset   bool
+	tests     string
+	timeout   time.Duration
+	env       []string
+}
+
+func newExecGrader() (*execGrader, error) {
+	name := viper.GetString(graderKey("exec.framework"))
+	framework, ok := testFrameworks[name]
+	if !ok && len(viper.GetStringSlice(graderKey("exec.command"))) == 0 {
+		return nil, fmt.Errorf("unknown grader.exec.framework %q, set a grader.exec.command to use it", name)
+	}
+	if !supportedTestFramework(name) {
+		return nil, fmt.Errorf("grader.exec.framework %q is not listed in supportedTestFrameworks", name)
+	}
+
+	g := execGrader{
+		framework: name,
+		file:      framework.file,
+		command:   framework.command,
+		scaffold:  framework.scaffold,
+		tests:     viper.GetString(graderKey("exec.tests")),
+		timeout:   30 * time.Second,
+	}
+
+	if file := viper.GetString(graderKey("exec.file")); file != "" {
+		g.file = file
+	}
+	if g.file == "" {
+		return nil, fmt.Errorf("grader.exec.framework %q needs a grader.exec.file", name)
+	}
+	// the code under test is written inside the scratch directory only
+	if rel, err := filepath.Rel(".", g.file); filepath.IsAbs(g.file) || err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return nil, fmt.Errorf("grader.exec.file %q must be a relative path inside the scratch directory", g.file)
+	}
+	if command := viper.GetStringSlice(graderKey("exec.command")); len(command) > 0 {
+		g.command = command
+	}
+	if g.tests == "" {
+		g.tests = viper.GetString("tests")
+	}
+	if key := graderKey("exec.timeout"); viper.IsSet(key) {
+		g.timeout = viper.GetDuration(key)
+	}
+	if g.timeout <= 0 {
+		return nil, fmt.Errorf("grader.exec.timeout must be positive")
+	}
+
+	switch patch := viper.GetString(graderKey("exec.patch")); patch {
+	case "", "response":
+	case "dataset":
+		g.dataset = true
+	default:
+		return nil, fmt.Errorf("grader.exec.patch must be response or dataset, not %q", patch)
+	}
+
+	env := []string{"PATH", "HOME", "LANG"}
+	if key := graderKey("exec.env"); viper.IsSet(key) {
+		env = viper.GetStringSlice(key)
+	}
+	for _, name := range env {
+		if value, ok := os.LookupEnv(name); ok {
+			g.env = append(g.env, name+"="+value)
+		}
+	}
+
+	return &g, nil
+}
+
+// Labeled is true with patch: dataset, where the tests judge the dataset's
+// patch and should agree with its passed label.
+func (g *execGrader) Labeled() bool {
+	return g.dataset
+}
+
+func (g *execGrader) Name() string {
+	return "exec:" + g.framework
+}
+
+func (g *execGrader) Grade(e interface{}, response string) (*Grade, error) {
+	fields := entryFields(e)
+	code, ok := fields["external"]
+	if !ok {
+		return nil, fmt.Errorf("grader.type exec needs pseudo data with an external column")
+	}
+
+	patch := response
+	if g.dataset {
+		patch = fields["patch"]
+	}
+
+	scratch, err := os.MkdirTemp("", "score-exec-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(scratch)
+
+	// the code and tests live apart from TMPDIR, which tools like go test
+	// refuse to treat as a module root
+	dir, tmp := filepath.Join(scratch, "src"), filepath.Join(scratch, "tmp")
+	for _, d := range []string{dir, tmp} {
+		if err := os.Mkdir(d, 0o755); err != nil {
+			return nil, err
+		}
+	}
+
+	if g.tests != "" {
+		if err := copyTests(g.tests, dir); err != nil {
+			return nil, fmt.Errorf("exec: copying tests: %w", err)
+		}
+	}
+	for name, content := range g.scaffold {
+		path := filepath.Join(dir, name)
+		if _, err := os.Stat(path); errors.Is(err, fs.ErrNotExist) {
+			if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	grade := Grade{Grader: g.Name()}
+	if err := g.applyPatch(dir, code, patch); err != nil {
+		grade.Rationale = err.Error()
+		return &grade, nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), g.timeout)
+	defer cancel()
+
+	var output bytes.Buffer
+	cmd := exec.CommandContext(ctx, g.command[0], g.command[1:]...)
+	cmd.Dir = dir
+	cmd.Env = append(append([]string{}, g.env...), "TMPDIR="+tmp)
+	cmd.Stdout = &output
+	cmd.Stderr = &output
+	cmd.WaitDelay = time.Second
+
+	err = cmd.Run()
+	var exitErr *exec.ExitError
+	switch {
+	case ctx.Err() == context.DeadlineExceeded:
+		grade.Rationale = fmt.Sprintf("timed out after %s", g.timeout)
+	case errors.As(err, &exitErr):
+		grade.Rationale = fmt.Sprintf("%s\n%s", exitErr, tail(execOutputLimit, output.String()))
+	case err != nil:
+		return nil, fmt.Errorf("exec: %w", err)
+	default:
+		grade.Passed = true
+		grade.Score = 1
+		grade.Rationale = tail(execOutputLimit, output.String())
+	}
+
+	grade.Rationale = strings.TrimSpace(grade.Rationale)
+	return &grade, nil
+}
+
+// applyPatch writes the code under test and applies a patch to it. Unified
+// diffs go through patch(1), whatever file their headers name; anything else
+// replaces the code.
+func (g *execGrader) applyPatch(dir, code, patch string) error {
+	path := filepath.Join(dir, g.file)
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+
+	if match := codeBlock.FindStringSubmatch(patch); match != nil {
+		patch = match[1]
+	}
+	if !unifiedDiff.MatchString(patch) {
+		return os.WriteFile(path, []byte(patch), 0o644)
+	}
+
+	if err := os.WriteFile(path, []byte(code), 0o644); err != nil {
+		return err
+	}
+
+	// the diff's header names whatever file it was made against, so the
+	// patch is pointed at the code under test instead
+	cmd := exec.Command("patch", "--batch", "--forward", "--silent", g.file)
+	cmd.Dir = dir
+	cmd.Stdin = strings.NewReader(patch + "\n")
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("patch does not apply: %v\n%s", err, tail(execOutputLimit, string(output)))
+	}
+	return nil
+}
+
+// copyTests copies a test file, or a directory of them, into dir.
+func copyTests(tests, dir string) error {
+	info, err := os.Stat(tests)
+	if err != nil {
+		return err
+	}
+	if !info.IsDir() {
+		data, err := os.ReadFile(tests)
+		if err != nil {
+			return err
+		}
+		return os.WriteFile(filepath.Join(dir, filepath.Base(tests)), data, info.Mode().Perm())
+	}
+
+	return filepath.WalkDir(tests, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(tests, path)
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(dir, rel)
+		if d.IsDir() {
+			return os.MkdirAll(target, 0o755)
+		}
+
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		return os.WriteFile(target, data, info.Mode().Perm())
+	})
+}
+
+func supportedTestFramework(name string) bool {
+	for _, supported := range viper.GetStringSlice("supportedTestFrameworks") {
+		if supported == name {
+			return true
+		}
+	}
+	return false
+}
+
+// tail keeps the last n characters of s.
+func tail(n int, s string) string {
+	runes := []rune(s)
+	if len(runes) <= n {
+		return s
+	}
+	return "..." + string(runes[len(runes)-n:])
+}
@@ -0,0 +1,139 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/spf13/viper"
+)
+
+// newShellGrader builds an exec grader for the shell framework whose test.sh
+// passes when main.sh prints "fixed".
+func newShellGrader(t *testing.T, config map[string]interface{}) *execGrader {
+	t.Helper()
+
+	tests := t.TempDir()
+	script := "out=$(sh main.sh)\n[ \"$out\" = fixed ]\n"
+	if err := os.WriteFile(filepath.Join(tests, "test.sh"), []byte(script), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	viper.Reset()
+	t.Cleanup(viper.Reset)
+	viper.Set("supportedTestFrameworks", []string{"shell"})
+	viper.Set("grader.exec.framework", "shell")
+	viper.Set("grader.exec.tests", tests)
+	for key, value := range config {
+		viper.Set(key, value)
+	}
+
+	g, err := newExecGrader()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return g
+}
+
+const shellDiff = "--- a/other.sh\n+++ b/other.sh\n@@ -1 +1 @@\n-echo hello\n+echo fixed"
+
+func TestExecGrade(t *testing.T) {
+	tests := []struct {
+		name      string
+		response  string
+		timeout   string
+		passed    bool
+		rationale string
+	}{
+		{name: "full file", response: "echo fixed\n", passed: true},
+		{name: "full file in code block", response: "Here it is:\n```sh\necho fixed\n```", passed: true},
+		{name: "full file failing", response: "echo broken\n", rationale: "exit status 1"},
+		{name: "diff", response: shellDiff, passed: true},
+		{name: "diff in code block", response: "```diff\n" + shellDiff + "\n```", passed: true},
+		{name: "diff not applying", response: "@@ -1 +1 @@\n-echo bye\n+echo fixed", rationale: "patch does not apply"},
+		{name: "timeout", response: "sleep 5\n", timeout: "100ms", rationale: "timed out after 100ms"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := map[string]interface{}{}
+			if tt.timeout != "" {
+				config["grader.exec.timeout"] = tt.timeout
+			}
+			g := newShellGrader(t, config)
+
+			grade, err := g.Grade(PseudoDataEntry{external: "echo hello\n"}, tt.response)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if grade.Passed != tt.passed {
+				t.Errorf("Passed = %v, want %v: %s", grade.Passed, tt.passed, grade.Rationale)
+			}
+			if !strings.Contains(grade.Rationale, tt.rationale) {
+				t.Errorf("Rationale = %q, want it to contain %q", grade.Rationale, tt.rationale)
+			}
+		})
+	}
+}
+
+func TestExecGradeDataset(t *testing.T) {
+	tests := []struct {
+		name    string
+		patch   string
+		passed  bool
+		want    string
+		correct bool
+	}{
+		{"good patch labeled passing", shellDiff, true, "true", true},
+		{"good patch labeled failing", shellDiff, false, "true", false},
+		{"bad patch labeled failing", "echo broken\n", false, "false", true},
+		{"bad patch labeled passing", "echo broken\n", true, "false", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			grader = newShellGrader(t, map[string]interface{}{"grader.exec.patch": "dataset"})
+			defer func() { grader = nil }()
+
+			e := PseudoDataEntry{external: "echo hello\n", patch: tt.patch, passed: tt.passed}
+			verdict, ok, _, err := gradeResponse(e, "the response is ignored")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !ok || verdict != tt.want {
+				t.Errorf("verdict = %q, %v, want %q", verdict, ok, tt.want)
+			}
+			if correct := verdict == expectedLabel(e); correct != tt.correct {
+				t.Errorf("verdict %q against label %q: correct = %v, want %v", verdict, expectedLabel(e), correct, tt.correct)
+			}
+		})
+	}
+}
+
+func TestExecGraderFile(t *testing.T) {
+	tests := []struct {
+		file    string
+		wantErr bool
+	}{
+		{"main.sh", false},
+		{"src/app/main.sh", false},
+		{"src/../main.sh", false},
+		{"/tmp/main.sh", true},
+		{"../main.sh", true},
+		{"src/../../main.sh", true},
+		{"..", true},
+	}
+
+	for _, tt := range tests {
+		viper.Reset()
+		viper.Set("supportedTestFrameworks", []string{"shell"})
+		viper.Set("grader.exec.framework", "shell")
+		viper.Set("grader.exec.file", tt.file)
+
+		if _, err := newExecGrader(); (err != nil) != tt.wantErr {
+			t.Errorf("grader.exec.file %q: error = %v, want error %v", tt.file, err, tt.wantErr)
+		}
+	}
+	viper.Reset()
+}
@@ -0,0 +1,353 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"text/template"
+
+	"github.com/spf13/viper"
+)
+
+// Grader decides whether a model's response to a data entry is acceptable,
+// for prompts whose output is not a verdict in itself. It is configured by
+// the grader section of the config; without one, responses are graded by the
+// verdict extractor.
+//
+// Grades are usually of the model's response, which should always pass.
+// Labeled graders instead grade something the row's label speaks to, such
+// as the dataset's own patch, and are compared to that label.
+type Grader interface {
+	Name() string
+	Grade(e interface{}, response string) (*Grade, error)
+	Labeled() bool
+}
+
+// Grade is a grader's assessment of one response, with Score between 0 and 1.
+type Grade struct {
+	Grader       string  `json:"grader"`
+	Score        float64 `json:"score"`
+	Passed       bool    `json:"passed"`
+	Inconclusive bool    `json:"inconclusive,omitempty"`
+	Rationale    string  `json:"rationale,omitempty"`
+}
+
+var grader Grader
+
+const defaultJudgePrompt = `You are grading the output of another model.
+
+Rubric:
+{{.rubric}}
+{{if .reference}}
+Reference answer:
+{{.reference}}
+{{end}}
+Output to grade:
+{{.output}}
+
+Reply with a JSON object with a "score" from 0 to {{.maxScore}} and a "justification" for it.`
+
+var judgeScorePattern = regexp.MustCompile(`(?i)score\W{0,3}\s*[:=]\s*(-?[0-9]+(?:\.[0-9]+)?)`)
+
+// graderFlags are the run flags overriding grader settings, which take
+// precedence over the grader.datasets entries.
+var graderFlags = map[string]*string{
+	"type":      &graderType,
+	"judge.llm": &judgeLLM,
+}
+
+// graderKey is the config key of a grader setting. Settings under
+// grader.datasets.<name>, where name is the data file's base name without its
+// extensions, override those of the grader section for that dataset:
+//
+//	grader:
+//	  type: exact
+//	  referenceColumn: answer
+//	  datasets:
+//	    summaries:
+//	      type: rougeL
+//	      threshold: 0.4
+func graderKey(key string) string {
+	if flag, ok := graderFlags[key]; ok && *flag != "" {
+		return "grader." + key
+	}
+
+	if dataFile := viper.GetString("dataFile"); dataFile != "" {
+		name := filepath.Base(datasetBase(dataFile))
+		if datasetKey := "grader.datasets." + strings.ToLower(name) + "." + key; viper.IsSet(datasetKey) {
+			return datasetKey
+		}
+	}
+
+	return "grader." + key
+}
+
+func initGrader(l *LLMs) error {
+	switch kind := viper.GetString(graderKey("type")); kind {
+	case "", "verdict":
+		grader = nil
+	case "exact", "normalized", "levenshtein", "tokenF1", "rougeL", "bleu":
+		similarity, err := newSimilarityGrader(kind)
+		if err != nil {
+			return err
+		}
+		grader = similarity
+	case "regex":
+		regex, err := newRegexGrader()
+		if err != nil {
+			return err
+		}
+		grader = regex
+	case "exec":
+		tester, err := newExecGrader()
+		if err != nil {
+			return err
+		}
+		grader = tester
+	case "judge":
+		if multiClass() {
+			return fmt.Errorf("grader.type judge cannot be combined with --labelColumn")
+		}
+		judge, err := newJudgeGrader(l)
+		if err != nil {
+			return err
+		}
+		grader = judge
+	default:
+		return fmt.Errorf("unknown grader.type %q", kind)
+	}
+	return nil
+}
+
+// gradeResponse returns the verdict label of a response and whether it has
+// one, along with the grade it was derived from when a grader is configured.
+// Graded responses are labelled "true" when they pass.
+func gradeResponse(e interface{}, response string) (string, bool, *Grade, error) {
+	if grader == nil {
+		verdict, ok := verdictExtractor.Extract(response)
+		return verdict, ok, nil, nil
+	}
+
+	grade, err := grader.Grade(e, response)
+	if err != nil {
+		return "", false, nil, err
+	}
+	if grade.Inconclusive {
+		return "", false, grade, nil
+	}
+	return strconv.FormatBool(grade.Passed), true, grade, nil
+}
+
+// referenceAnswer is the value of grader.referenceColumn for a data entry.
+func referenceAnswer(e interface{}) string {
+	column := viper.GetString(graderKey("referenceColumn"))
+	if column == "" {
+		return ""
+	}
+	return entryFields(e)[column]
+}
+
+// judgeGrader asks another model to score a response against a rubric and
+// the dataset's reference answer:
+//
+//	grader:
+//	  type: judge
+//	  referenceColumn: answer
+//	  judge:
+//	    llm: gpt-4
+//	    rubric: The explanation names the vulnerable function and why it is unsafe.
+//	    maxScore: 10
+//	    passThreshold: 0.7
+//
+// The judge's reply may be JSON with a score (a number, true/false or
+// pass/fail) and a justification, a "score: n" line, or end in pass/fail.
+// Numeric scores are divided by maxScore and pass at passThreshold.
+type judgeGrader struct {
+	provider  Provider
+	prompt    *template.Template
+	system    string
+	rubric    string
+	maxScore  float64
+	threshold float64
+}
+
+func newJudgeGrader(l *LLMs) (*judgeGrader, error) {
+	llm := viper.GetString(graderKey("judge.llm"))
+	if llm == "" {
+		return nil, fmt.Errorf("grader.type judge needs a grader.judge.llm")
+	}
+
+	provider, err := l.newProvider(llm)
+	if err != nil {
+		return nil, fmt.Errorf("judge: %w", err)
+	}
+
+	j := judgeGrader{
+		provider:  provider,
+		system:    viper.GetString(graderKey("judge.system")),
+		rubric:    viper.GetString(graderKey("judge.rubric")),
+		maxScore:  1,
+		threshold: 0.5,
+	}
+
+	if rubricFile := viper.GetString(graderKey("judge.rubricFile")); rubricFile != "" {
+		data, err := os.ReadFile(rubricFile)
+		if err != nil {
+			return nil, fmt.Errorf("judge: %w", err)
+		}
+		j.rubric = string(data)
+	}
+	if key := graderKey("judge.maxScore"); viper.IsSet(key) {
+		j.maxScore = viper.GetFloat64(key)
+	}
+	if key := graderKey("judge.passThreshold"); viper.IsSet(key) {
+		j.threshold = viper.GetFloat64(key)
+	}
+	if j.maxScore <= 0 {
+		return nil, fmt.Errorf("grader.judge.maxScore must be positive")
+	}
+
+	prompt := viper.GetString(graderKey("judge.prompt"))
+	if prompt == "" {
+		prompt = defaultJudgePrompt
+	}
+	j.prompt, err = template.New("judge").Option("missingkey=error").Funcs(promptFuncs).Parse(prompt)
+	if err != nil {
+		return nil, fmt.Errorf("invalid grader.judge.prompt: %w", err)
+	}
+
+	return &j, nil
+}
+
+func (j *judgeGrader) Labeled() bool {
+	return false
+}
+
+func (j *judgeGrader) Name() string {
+	return "judge:" + j.provider.Model()
+}
+
+func (j *judgeGrader) Grade(e interface{}, response string) (*Grade, error) {
+	fields := entryFields(e)
+	if fields == nil {
+		fields = map[string]string{}
+	}
+	fields["output"] = response
+	fields["reference"] = referenceAnswer(e)
+	fields["rubric"] = j.rubric
+	fields["maxScore"] = strconv.FormatFloat(j.maxScore, 'f', -1, 64)
+
+	var prompt strings.Builder
+	if err := j.prompt.Execute(&prompt, fields); err != nil {
+		return nil, fmt.Errorf("judge: %w", err)
+	}
+
+	req := CompletionRequest{
+		Model:          j.provider.Model(),
+		System:         j.system,
+		Prompt:         prompt.String(),
+		ResponseFormat: "json",
+	}
+	if params := paramsFor(j.provider); params != nil {
+		req.Params = params
+	}
+
+	judgement, err := processWithRetries(func() (*CompletionResponse, error) {
+		return j.provider.Complete(context.Background(), req)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("judge: %w", err)
+	}
+
+	grade := Grade{Grader: j.Name()}
+	score, rationale, ok := j.parse(judgement.Content)
+	if !ok {
+		grade.Inconclusive = true
+		grade.Rationale = strings.TrimSpace(judgement.Content)
+		return &grade, nil
+	}
+
+	grade.Score = score
+	grade.Passed = score >= j.threshold
+	grade.Rationale = rationale
+	return &grade, nil
+}
+
+// parse reads the judge's score, scaled to between 0 and 1, and its
+// justification.
+func (j *judgeGrader) parse(judgement string) (float64, string, bool) {
+	for _, key := range []string{"score", "verdict", "passed", "pass", "result"} {
+		value, ok := jsonPath(judgement, []string{key})
+		if !ok {
+			continue
+		}
+		score, ok := j.score(value)
+		if !ok {
+			return 0, "", false
+		}
+
+		var rationale string
+		for _, key := range []string{"justification", "rationale", "reasoning", "explanation", "reason"} {
+			if text, ok := jsonPath(judgement, []string{key}); ok {
+				if s, ok := text.(string); ok {
+					rationale = strings.TrimSpace(s)
+					break
+				}
+			}
+		}
+		return score, rationale, true
+	}
+
+	if match := judgeScorePattern.FindStringSubmatchIndex(judgement); match != nil {
+		if score, ok := j.score(judgement[match[2]:match[3]]); ok {
+			return score, strings.TrimSpace(judgement[:match[0]] + judgement[match[1]:]), true
+		}
+	}
+
+	lines := strings.Split(strings.TrimSpace(judgement), "\n")
+	words := strings.Fields(verdictNoise.ReplaceAllString(lines[len(lines)-1], " "))
+	for i := len(words) - 1; i >= 0; i-- {
+		if score, ok := passFail(strings.ToLower(words[i])); ok {
+			return score, strings.TrimSpace(strings.Join(lines[:len(lines)-1], "\n")), true
+		}
+	}
+
+	return 0, "", false
+}
+
+func (j *judgeGrader) score(value interface{}) (float64, bool) {
+	switch v := value.(type) {
+	case bool:
+		if v {
+			return 1, true
+		}
+		return 0, true
+	case float64:
+		return math.Max(0, math.Min(1, v/j.maxScore)), true
+	case string:
+		if f, err := strconv.ParseFloat(strings.TrimSpace(v), 64); err == nil {
+			return j.score(f)
+		}
+		return passFail(normalizeVerdict(v))
+	}
+	return 0, false
+}
+
+func passFail(value string) (float64, bool) {
+	for _, v := range defaultTrueValues {
+		if value == v {
+			return 1, true
+		}
+	}
+	for _, v := range defaultFalseValues {
+		if value == v {
+			return 0, true
+		}
+	}
+	return 0, false
+}
@@ -0,0 +1,259 @@
+package cmd
+
+import (
+	"fmt"
+	"math"
+	"sort"
+)
+
+// confusionMatrix counts a model's verdicts against the expected labels, with
+// "true" (the test passes) as the positive class. Inconclusive results are
+// left out of the matrix and counted by their expected label instead.
+type confusionMatrix struct {
+	TP                int `json:"tp"`
+	FP                int `json:"fp"`
+	TN                int `json:"tn"`
+	FN                int `json:"fn"`
+	InconclusiveTrue  int `json:"inconclusiveTrue"`
+	InconclusiveFalse int `json:"inconclusiveFalse"`
+}
+
+// labelMatrix counts expected labels (rows) against verdicts (columns) in
+// multi-class runs. Inconclusive verdicts have a column of their own.
+type labelMatrix struct {
+	Labels []string                  `json:"labels"`
+	Counts map[string]map[string]int `json:"counts"`
+}
+
+// classMetrics are the one-vs-rest metrics of a single label.
+type classMetrics struct {
+	Label     string  `json:"label"`
+	Precision float64 `json:"precision"`
+	Recall    float64 `json:"recall"`
+	F1        float64 `json:"f1"`
+	Support   int     `json:"support"`
+}
+
+// classificationMetrics are derived from a confusion matrix. In multi-class
+// runs they are macro averages over the labels, where a label's own metric is
+// 0 when its denominator is zero, and MCC is its multi-class generalization.
+// A metric whose denominator is zero is undefined, NaN, and reported as 0.
+type classificationMetrics struct {
+	Precision        float64 `json:"precision"`
+	Recall           float64 `json:"recall"`
+	F1               float64 `json:"f1"`
+	Specificity      float64 `json:"specificity"`
+	BalancedAccuracy float64 `json:"balancedAccuracy"`
+	MCC              float64 `json:"mcc"`
+}
+
+// modelSummary is the per-model accuracy and, with --samples, how stable the
+// model's verdicts were across repeated queries of the same row. MeanScore is
+// the average grade of graded runs.
+type modelSummary struct {
+	LLM          string                `json:"llm"`
+	Total        int                   `json:"total"`
+	Passed       int                   `json:"passed"`
+	Failed       int                   `json:"failed"`
+	Inconclusive int                   `json:"inconclusive"`
+	Accuracy     float64               `json:"accuracy"`
+	Stability    float64               `json:"stability"`
+	Flaky        int                   `json:"flaky"`
+	MeanScore    *float64              `json:"meanScore,omitempty"`
+	Confusion    *confusionMatrix      `json:"confusion,omitempty"`
+	Matrix       *labelMatrix          `json:"matrix,omitempty"`
+	Classes      []classMetrics        `json:"classes,omitempty"`
+	Metrics      classificationMetrics `json:"metrics"`
+	Intervals    *metricIntervals      `json:"intervals,omitempty"`
+}
+
+// add counts n results of an outcome.
+func (c *confusionMatrix) add(o outcome, n int) {
+	switch {
+	case o.inconclusive && o.expected == "true":
+		c.InconclusiveTrue += n
+	case o.inconclusive:
+		c.InconclusiveFalse += n
+	case o.expected == "true" && o.verdict == "true":
+		c.TP += n
+	case o.expected == "true":
+		c.FN += n
+	case o.verdict == "true":
+		c.FP += n
+	default:
+		c.TN += n
+	}
+}
+
+func (c confusionMatrix) metrics() classificationMetrics {
+	tp, fp, tn, fn := float64(c.TP), float64(c.FP), float64(c.TN), float64(c.FN)
+
+	m := classificationMetrics{
+		Precision:   metricRatio(tp, tp+fp),
+		Recall:      metricRatio(tp, tp+fn),
+		F1:          metricRatio(2*tp, 2*tp+fp+fn),
+		Specificity: metricRatio(tn, tn+fp),
+		MCC:         metricRatio(tp*tn-fp*fn, math.Sqrt((tp+fp)*(tp+fn)*(tn+fp)*(tn+fn))),
+	}
+	m.BalancedAccuracy = (m.Recall + m.Specificity) / 2
+
+	return m
+}
+
+func newLabelMatrix(outcomes outcomeCounts) *labelMatrix {
+	lm := labelMatrix{Counts: make(map[string]map[string]int)}
+
+	seen := make(map[string]bool)
+	for o, n := range outcomes {
+		verdict := o.verdict
+		if o.inconclusive {
+			verdict = inconclusiveLabel
+		} else if !seen[verdict] {
+			seen[verdict] = true
+			lm.Labels = append(lm.Labels, verdict)
+		}
+		if !seen[o.expected] {
+			seen[o.expected] = true
+			lm.Labels = append(lm.Labels, o.expected)
+		}
+
+		if lm.Counts[o.expected] == nil {
+			lm.Counts[o.expected] = make(map[string]int)
+		}
+		lm.Counts[o.expected][verdict] += n
+	}
+	sort.Strings(lm.Labels)
+
+	return &lm
+}
+
+// classes returns the metrics of each label, leaving inconclusive results out.
+func (lm *labelMatrix) classes() []classMetrics {
+	classes := make([]classMetrics, 0, len(lm.Labels))
+	for _, label := range lm.Labels {
+		var tp, predicted, actual float64
+		for _, expected := range lm.Labels {
+			predicted += float64(lm.Counts[expected][label])
+		}
+		for _, verdict := range lm.Labels {
+			actual += float64(lm.Counts[label][verdict])
+		}
+		tp = float64(lm.Counts[label][label])
+
+		c := classMetrics{
+			Label:     label,
+			Precision: ratio(tp, predicted),
+			Recall:    ratio(tp, actual),
+			Support:   int(actual) + lm.Counts[label][inconclusiveLabel],
+		}
+		c.F1 = ratio(2*c.Precision*c.Recall, c.Precision+c.Recall)
+		classes = append(classes, c)
+	}
+	return classes
+}
+
+func (lm *labelMatrix) metrics() classificationMetrics {
+	var m classificationMetrics
+	var total, correct, sumPredictedActual, sumPredicted2, sumActual2 float64
+
+	for _, label := range lm.Labels {
+		for _, verdict := range lm.Labels {
+			total += float64(lm.Counts[label][verdict])
+		}
+	}
+
+	for _, c := range lm.classes() {
+		m.Precision += c.Precision
+		m.Recall += c.Recall
+		m.F1 += c.F1
+
+		var predicted, actual float64
+		for _, other := range lm.Labels {
+			predicted += float64(lm.Counts[other][c.Label])
+			actual += float64(lm.Counts[c.Label][other])
+		}
+		tp := float64(lm.Counts[c.Label][c.Label])
+		m.Specificity += ratio(total-predicted-actual+tp, total-actual)
+
+		correct += tp
+		sumPredictedActual += predicted * actual
+		sumPredicted2 += predicted * predicted
+		sumActual2 += actual * actual
+	}
+
+	if n := float64(len(lm.Labels)); n > 0 {
+		m.Precision /= n
+		m.Recall /= n
+		m.F1 /= n
+		m.Specificity /= n
+	}
+	m.BalancedAccuracy = m.Recall
+	m.MCC = metricRatio(correct*total-sumPredictedActual, math.Sqrt((total*total-sumPredicted2)*(total*total-sumActual2)))
+
+	return m
+}
+
+// outcomeMetrics computes the metrics of a set of results, binary or
+// multi-class depending on --labelColumn.
+func outcomeMetrics(outcomes outcomeCounts) classificationMetrics {
+	if multiClass() {
+		return newLabelMatrix(outcomes).metrics()
+	}
+
+	var c confusionMatrix
+	for o, n := range outcomes {
+		c.add(o, n)
+	}
+	return c.metrics()
+}
+
+func ratio(numerator, denominator float64) float64 {
+	if denominator == 0 {
+		return 0
+	}
+	return numerator / denominator
+}
+
+// metricRatio is like ratio but NaN when the denominator is zero, so that an
+// undefined metric can be told apart from a metric of 0.
+func metricRatio(numerator, denominator float64) float64 {
+	if denominator == 0 {
+		return math.NaN()
+	}
+	return numerator / denominator
+}
+
+// reported replaces undefined metrics by 0.
+func (m classificationMetrics) reported() classificationMetrics {
+	for _, value := range []*float64{&m.Precision, &m.Recall, &m.F1, &m.Specificity, &m.BalancedAccuracy, &m.MCC} {
+		if math.IsNaN(*value) {
+			*value = 0
+		}
+	}
+	return m
+}
+
+func (s modelSummary) String() string {
+	score := fmt.Sprintf("%s: %.2f%% (%d/%d, %d inconclusive)", s.LLM, s.Accuracy, s.Passed, s.Total, s.Inconclusive)
+	if getSamples() > 1 {
+		score += fmt.Sprintf(", stability %.2f%% (%d flaky)", s.Stability, s.Flaky)
+	}
+	if s.MeanScore != nil {
+		score += fmt.Sprintf(", mean score %.3f", *s.MeanScore)
+	}
+	return score
+}
+
+func (c confusionMatrix) String() string {
+	return fmt.Sprintf("TP %d  FP %d  TN %d  FN %d  inconclusive (expected true/false) %d/%d",
+		c.TP, c.FP, c.TN, c.FN, c.InconclusiveTrue, c.InconclusiveFalse)
+}
+
+func (c classMetrics) String() string {
+	return fmt.Sprintf("%s: precision %.3f  recall %.3f  F1 %.3f  support %d", c.Label, c.Precision, c.Recall, c.F1, c.Support)
+}
+
+func (m classificationMetrics) String() string {
+	return fmt.Sprintf("precision %.3f  recall %.3f  F1 %.3f  specificity %.3f  balanced accuracy %.3f  MCC %.3f",
+		m.Precision, m.Recall, m.F1, m.Specificity, m.BalancedAccuracy, m.MCC)
+}
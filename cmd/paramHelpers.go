@@ -0,0 +1,216 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/spf13/viper"
+)
+
+// GenerationParams are the sampling settings sent with every request. Unset
+// fields are left to the provider's defaults.
+type GenerationParams struct {
+	Temperature    *float64 `json:"temperature,omitempty"`
+	TopP           *float64 `json:"topP,omitempty"`
+	MaxTokens      *int     `json:"maxTokens,omitempty"`
+	Seed           *int     `json:"seed,omitempty"`
+	Stop           []string `json:"stop,omitempty"`
+	ResponseFormat string   `json:"responseFormat,omitempty"`
+}
+
+// modelParams holds the effective parameters of every model in the run, keyed
+// by the llm as passed to --llms, so they can be sent with requests and shown
+// in reports. providerLLMs finds the llm a provider was built for.
+var (
+	modelParams  = map[string]*GenerationParams{}
+	providerLLMs = map[Provider]string{}
+)
+
+// initModelParams resolves the parameters for an llm from the models section
+// of the config and any --param overrides. Later sources win:
+//
+//	models:
+//	  '*':
+//	    temperature: 0
+//	  gpt-4:
+//	    seed: 42
+//	    maxTokens: 800
+//	  ollama:llama3:
+//	    topP: 0.9
+//	    stop: ["</answer>"]
+//
+// Entries are matched by the llm as passed to --llms, or by its model name.
+func initModelParams(llm, model string) error {
+	var params GenerationParams
+
+	models := viper.GetStringMap("models")
+	for _, key := range []string{"*", model, llm} {
+		entry, ok := models[strings.ToLower(key)]
+		if !ok || entry == nil {
+			continue
+		}
+
+		var p GenerationParams
+		if err := decodeParams(entry, &p); err != nil {
+			return fmt.Errorf("models.%s: %w", key, err)
+		}
+		params.merge(&p)
+	}
+
+	overrides, err := parseParamOverrides(viper.GetStringSlice("params"))
+	if err != nil {
+		return err
+	}
+	params.merge(overrides)
+
+	if params.Temperature != nil && (*params.Temperature < 0 || *params.Temperature > 2) {
+		return fmt.Errorf("%s: temperature must be between 0 and 2", llm)
+	}
+	if params.MaxTokens != nil && *params.MaxTokens <= 0 {
+		return fmt.Errorf("%s: maxTokens must be positive", llm)
+	}
+	if params.ResponseFormat != "" && params.ResponseFormat != "json" && params.ResponseFormat != "text" {
+		return fmt.Errorf("%s: unknown responseFormat %q, expected json or text", llm, params.ResponseFormat)
+	}
+
+	modelParams[llm] = &params
+	return nil
+}
+
+// paramsFor returns the parameters a provider's requests are sent with, or
+// nil when none are set.
+func paramsFor(provider Provider) *GenerationParams {
+	if params, ok := modelParams[providerLLMs[provider]]; ok && !params.empty() {
+		return params
+	}
+	return nil
+}
+
+// decodeParams converts a config entry through JSON so that keys match the
+// struct case-insensitively, as viper lowercases them.
+func decodeParams(entry interface{}, params *GenerationParams) error {
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, params)
+}
+
+// parseParamOverrides reads --param key=value flags. stop may be repeated.
+func parseParamOverrides(values []string) (*GenerationParams, error) {
+	var params GenerationParams
+
+	for _, value := range values {
+		key, raw, ok := strings.Cut(value, "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid --param %q, expected key=value", value)
+		}
+
+		var err error
+		switch strings.ToLower(strings.TrimSpace(key)) {
+		case "temperature":
+			params.Temperature, err = parseFloatParam(raw)
+		case "topp", "top_p":
+			params.TopP, err = parseFloatParam(raw)
+		case "maxtokens", "max_tokens":
+			params.MaxTokens, err = parseIntParam(raw)
+		case "seed":
+			params.Seed, err = parseIntParam(raw)
+		case "stop":
+			params.Stop = append(params.Stop, raw)
+		case "responseformat", "response_format":
+			params.ResponseFormat = raw
+		default:
+			return nil, fmt.Errorf("unknown --param %q", key)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid --param %q: %w", value, err)
+		}
+	}
+
+	return &params, nil
+}
+
+func parseFloatParam(raw string) (*float64, error) {
+	f, err := strconv.ParseFloat(strings.TrimSpace(raw), 64)
+	if err != nil {
+		return nil, err
+	}
+	return &f, nil
+}
+
+func parseIntParam(raw string) (*int, error) {
+	i, err := strconv.Atoi(strings.TrimSpace(raw))
+	if err != nil {
+		return nil, err
+	}
+	return &i, nil
+}
+
+func (p *GenerationParams) merge(other *GenerationParams) {
+	if other.Temperature != nil {
+		p.Temperature = other.Temperature
+	}
+	if other.TopP != nil {
+		p.TopP = other.TopP
+	}
+	if other.MaxTokens != nil {
+		p.MaxTokens = other.MaxTokens
+	}
+	if other.Seed != nil {
+		p.Seed = other.Seed
+	}
+	if other.Stop != nil {
+		p.Stop = other.Stop
+	}
+	if other.ResponseFormat != "" {
+		p.ResponseFormat = other.ResponseFormat
+	}
+}
+
+func (p *GenerationParams) empty() bool {
+	return p.Temperature == nil && p.TopP == nil && p.MaxTokens == nil && p.Seed == nil &&
+		p.Stop == nil && p.ResponseFormat == ""
+}
+
+// String lists the set parameters, e.g. "maxTokens=800 seed=42 temperature=0".
+func (p *GenerationParams) String() string {
+	var parts []string
+	if p.Temperature != nil {
+		parts = append(parts, "temperature="+strconv.FormatFloat(*p.Temperature, 'f', -1, 64))
+	}
+	if p.TopP != nil {
+		parts = append(parts, "topP="+strconv.FormatFloat(*p.TopP, 'f', -1, 64))
+	}
+	if p.MaxTokens != nil {
+		parts = append(parts, "maxTokens="+strconv.Itoa(*p.MaxTokens))
+	}
+	if p.Seed != nil {
+		parts = append(parts, "seed="+strconv.Itoa(*p.Seed))
+	}
+	if p.Stop != nil {
+		parts = append(parts, fmt.Sprintf("stop=%q", p.Stop))
+	}
+	if p.ResponseFormat != "" {
+		parts = append(parts, "responseFormat="+p.ResponseFormat)
+	}
+	if len(parts) == 0 {
+		return "provider defaults"
+	}
+
+	sort.Strings(parts)
+	return strings.Join(parts, " ")
+}
+
+// openAiTemperature works around go-openai dropping a zero temperature, which
+// would leave the API at its default of 1.
+func openAiTemperature(t float64) float32 {
+	if t == 0 {
+		return math.SmallestNonzeroFloat32
+	}
+	return float32(t)
+}
@@ -0,0 +1,252 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"text/template"
+	"text/template/parse"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+var (
+	promptOnce     sync.Once
+	promptText     string
+	promptTemplate *template.Template
+	promptSystem   string
+	promptMessages []Message
+)
+
+// conversationFile is the layout of a YAML prompt file, or of the front-matter
+// of a text prompt file:
+//
+//	system: You review patches for security issues.
+//	messages:
+//	  - role: user
+//	    content: "diff --git a/x.go ..."
+//	  - role: assistant
+//	    content: "false"
+//	prompt: |
+//	  {{.diffDelta | fence "diff"}}
+//
+// The messages are sent in order ahead of the rendered prompt, which is always
+// the final user turn. With front-matter the prompt is the text after it.
+type conversationFile struct {
+	System   string    `mapstructure:"system"`
+	Messages []Message `mapstructure:"messages"`
+	Prompt   string    `mapstructure:"prompt"`
+}
+
+var frontMatterEnd = regexp.MustCompile(`(?m)^---\r?\n|^---$`)
+
+var promptFuncs = template.FuncMap{
+	"b64dec":   Base64Decode,
+	"b64enc":   Base64Encode,
+	"fence":    fence,
+	"lower":    strings.ToLower,
+	"trim":     strings.TrimSpace,
+	"truncate": truncate,
+	"upper":    strings.ToUpper,
+}
+
+// loadPrompt reads the prompt once per run. Prompts containing "{{" are
+// parsed as Go text/templates over the dataset columns of each row, e.g.
+//
+//	Is this patch safe?
+//	{{.patch | truncate 4000 | fence "go"}}
+//	Requirements: {{.vuln}}
+//
+// Any other prompt has the row data appended to it.
+func loadPrompt() {
+	argPrompt := viper.GetString("prompt")
+	argPromptFile := viper.GetString("promptFile")
+	if argPrompt == "" && argPromptFile == "" {
+		cobra.CompError(UsageMsg)
+		os.Exit(1)
+	}
+
+	if argPromptFile != "" {
+		dat, err := os.ReadFile(argPromptFile)
+		cobra.CheckErr(err)
+		promptText = string(dat)
+
+		conversation, err := parseConversation(argPromptFile, promptText)
+		cobra.CheckErr(err)
+		if conversation != nil {
+			promptSystem = conversation.System
+			promptMessages = conversation.Messages
+			promptText = conversation.Prompt
+		}
+		// a conversation may leave the final turn to --prompt
+		if promptText == "" {
+			promptText = argPrompt
+		}
+		if promptText == "" {
+			cobra.CheckErr(fmt.Errorf("%s has no prompt for the final turn", argPromptFile))
+		}
+	} else {
+		promptText = argPrompt
+	}
+
+	if strings.Contains(promptText, "{{") {
+		tmpl, err := template.New("prompt").Option("missingkey=error").Funcs(promptFuncs).Parse(promptText)
+		cobra.CheckErr(err)
+		promptTemplate = tmpl
+	}
+}
+
+// parseConversation reads a .yaml/.yml prompt file, or a text prompt file
+// starting with a "---" front-matter block. Other files are plain prompts and
+// return nil.
+func parseConversation(path, text string) (*conversationFile, error) {
+	var header, body string
+	switch ext := strings.ToLower(filepath.Ext(path)); {
+	case ext == ".yaml" || ext == ".yml":
+		header = text
+	case strings.HasPrefix(text, "---\n") || strings.HasPrefix(text, "---\r\n"):
+		rest := text[strings.Index(text, "\n")+1:]
+		end := frontMatterEnd.FindStringIndex(rest)
+		if end == nil {
+			return nil, fmt.Errorf("%s: front-matter is not closed by a \"---\" line", path)
+		}
+		header, body = rest[:end[0]], rest[end[1]:]
+	default:
+		return nil, nil
+	}
+
+	v := viper.New()
+	v.SetConfigType("yaml")
+	if err := v.ReadConfig(strings.NewReader(header)); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	var conversation conversationFile
+	if err := v.Unmarshal(&conversation); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	if body != "" {
+		if conversation.Prompt != "" {
+			return nil, fmt.Errorf("%s: prompt is set in both the front-matter and the body", path)
+		}
+		conversation.Prompt = body
+	}
+
+	for i, message := range conversation.Messages {
+		if message.Role != "user" && message.Role != "assistant" {
+			return nil, fmt.Errorf("%s: message %d has role %q, expected user or assistant", path, i+1, message.Role)
+		}
+	}
+
+	return &conversation, nil
+}
+
+func createPrompt(e interface{}, appendedData string) string {
+	prompt, err := renderPrompt(e, appendedData)
+	cobra.CheckErr(err)
+
+	return prompt
+}
+
+// renderPrompt is createPrompt returning template errors, such as a column
+// missing from the row.
+func renderPrompt(e interface{}, appendedData string) (string, error) {
+	promptOnce.Do(loadPrompt)
+
+	if promptTemplate == nil {
+		return promptText + appendedData, nil
+	}
+
+	var sb strings.Builder
+	if err := promptTemplate.Execute(&sb, entryFields(e)); err != nil {
+		return "", err
+	}
+
+	return sb.String(), nil
+}
+
+// templateFields lists the dataset columns a prompt template references, as
+// {{.column}} or {{index . "column"}}. Fields inside range and with blocks
+// belong to another dot and are left out.
+func templateFields(tmpl *template.Template) []string {
+	seen := make(map[string]bool)
+	var fields []string
+	add := func(field string) {
+		if !seen[field] {
+			seen[field] = true
+			fields = append(fields, field)
+		}
+	}
+
+	var walk func(node parse.Node)
+	walk = func(node parse.Node) {
+		switch n := node.(type) {
+		case *parse.ListNode:
+			if n == nil {
+				return
+			}
+			for _, child := range n.Nodes {
+				walk(child)
+			}
+		case *parse.ActionNode:
+			walk(n.Pipe)
+		case *parse.IfNode:
+			walk(n.Pipe)
+			walk(n.List)
+			walk(n.ElseList)
+		case *parse.RangeNode:
+			walk(n.Pipe)
+		case *parse.WithNode:
+			walk(n.Pipe)
+		case *parse.PipeNode:
+			if n == nil {
+				return
+			}
+			for _, cmd := range n.Cmds {
+				walk(cmd)
+			}
+		case *parse.CommandNode:
+			if len(n.Args) >= 3 {
+				ident, isIdent := n.Args[0].(*parse.IdentifierNode)
+				_, isDot := n.Args[1].(*parse.DotNode)
+				column, isString := n.Args[2].(*parse.StringNode)
+				if isIdent && ident.Ident == "index" && isDot && isString {
+					add(column.Text)
+				}
+			}
+			for _, arg := range n.Args {
+				walk(arg)
+			}
+		case *parse.FieldNode:
+			add(n.Ident[0])
+		case *parse.ChainNode:
+			walk(n.Node)
+		}
+	}
+	walk(tmpl.Tree.Root)
+
+	return fields
+}
+
+// truncate keeps the first n characters of s.
+func truncate(n int, s string) string {
+	runes := []rune(s)
+	if n < 0 || len(runes) <= n {
+		return s
+	}
+	return string(runes[:n])
+}
+
+// fence wraps s in a markdown code block, using a fence longer than any run
+// of backticks inside s.
+func fence(lang, s string) string {
+	ticks := "```"
+	for strings.Contains(s, ticks) {
+		ticks += "`"
+	}
+	return fmt.Sprintf("%s%s\n%s\n%s", ticks, lang, strings.TrimRight(s, "\n"), ticks)
+}
@@ -0,0 +1,205 @@
+package cmd
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+type Usage struct {
+	PromptTokens     int `json:"promptTokens"`
+	CompletionTokens int `json:"completionTokens"`
+	TotalTokens      int `json:"totalTokens"`
+}
+
+// Message is one turn of a conversation sent ahead of the test prompt.
+type Message struct {
+	Role    string `json:"role" mapstructure:"role"`
+	Content string `json:"content" mapstructure:"content"`
+}
+
+type CompletionRequest struct {
+	Model  string `json:"model"`
+	System string `json:"system,omitempty"`
+
+	// Messages are the user/assistant turns, such as few-shot examples, that
+	// come before Prompt. Prompt is always sent as the final user turn.
+	Messages []Message `json:"messages,omitempty"`
+	Prompt   string    `json:"prompt"`
+
+	// ResponseFormat asks providers with a native JSON mode to use it.
+	ResponseFormat string `json:"responseFormat,omitempty"`
+
+	// Params are the model's generation settings, nil if none are set.
+	Params *GenerationParams `json:"params,omitempty"`
+
+	// Sample numbers repeated requests for the same row with --samples so
+	// each is cached and recorded separately. It is never sent to an API.
+	Sample int `json:"sample,omitempty"`
+
+	// Expected is the row's expected label. Only offline providers such as
+	// mock look at it; it is never sent to a real API.
+	Expected string `json:"-"`
+}
+
+type CompletionResponse struct {
+	Content string        `json:"content"`
+	Model   string        `json:"model"`
+	Usage   Usage         `json:"usage"`
+	Latency time.Duration `json:"latency"`
+}
+
+// Provider is implemented by every LLM backend the runners can query.
+type Provider interface {
+	Name() string
+	Model() string
+	Complete(ctx context.Context, req CompletionRequest) (*CompletionResponse, error)
+}
+
+// ProviderFactory builds a provider for the given model name.
+type ProviderFactory func(model string) (Provider, error)
+
+var (
+	providerFactories = map[string]ProviderFactory{}
+	providerPrefixes  = map[string]string{}
+)
+
+// RegisterProvider makes a provider available under its name, and optionally
+// for any model whose name starts with one of the given prefixes.
+func RegisterProvider(name string, factory ProviderFactory, prefixes ...string) {
+	providerFactories[name] = factory
+	for _, prefix := range prefixes {
+		providerPrefixes[prefix] = name
+	}
+}
+
+func init() {
+	// add additional llm support here
+	RegisterProvider("openai", newOpenAi, "gpt")
+	RegisterProvider("anthropic", newAnthropic, "claude")
+	RegisterProvider("ollama", newLocalFactory("ollama"))
+	RegisterProvider("llamacpp", newLocalFactory("llamacpp"))
+	RegisterProvider("mock", newMock)
+}
+
+func newCompletionRequest(provider Provider, e interface{}, prompt string) CompletionRequest {
+	promptOnce.Do(loadPrompt)
+
+	// --systemPrompt overrides the system message of a prompt file
+	system := viper.GetString("systemPrompt")
+	if system == "" {
+		system = promptSystem
+	}
+
+	req := CompletionRequest{
+		Model:          provider.Model(),
+		System:         system,
+		Messages:       promptMessages,
+		Prompt:         prompt,
+		ResponseFormat: verdictExtractor.ResponseFormat(),
+		Expected:       expectedLabel(e),
+	}
+
+	if params := paramsFor(provider); params != nil {
+		req.Params = params
+		if params.ResponseFormat != "" {
+			req.ResponseFormat = params.ResponseFormat
+		}
+	}
+
+	return req
+}
+
+// expectedLabel is the label a data entry should be graded as: the value of
+// --labelColumn, normalized like verdicts, or else its passed column. With a
+// grader that is not labeled every response is expected to pass.
+func expectedLabel(e interface{}) string {
+	if grader != nil && !grader.Labeled() {
+		return "true"
+	}
+	if column := viper.GetString("labelColumn"); column != "" {
+		return normalizeVerdict(entryFields(e)[column])
+	}
+
+	switch v := e.(type) {
+	case DataEntry:
+		return strconv.FormatBool(v.passed)
+	case *DataEntry:
+		return strconv.FormatBool(v.passed)
+	case PseudoDataEntry:
+		return strconv.FormatBool(v.passed)
+	case *PseudoDataEntry:
+		return strconv.FormatBool(v.passed)
+	}
+	return ""
+}
+
+// resolveProvider finds the factory for an llm passed via --llms. Lookups are
+// tried in order: an explicit "provider:model" name, the modelProviders
+// section of the config, then the longest matching model-name prefix.
+func resolveProvider(llm string) (ProviderFactory, string, error) {
+	if name, model, ok := strings.Cut(llm, ":"); ok {
+		if factory, ok := providerFactories[name]; ok {
+			return factory, model, nil
+		}
+	}
+
+	if name, ok := viper.GetStringMapString("modelProviders")[strings.ToLower(llm)]; ok {
+		factory, ok := providerFactories[name]
+		if !ok {
+			return nil, "", fmt.Errorf("modelProviders maps %q to unknown provider %q", llm, name)
+		}
+		return factory, llm, nil
+	}
+
+	prefixes := make([]string, 0, len(providerPrefixes))
+	for prefix := range providerPrefixes {
+		prefixes = append(prefixes, prefix)
+	}
+	sort.Slice(prefixes, func(i, j int) bool { return len(prefixes[i]) > len(prefixes[j]) })
+
+	for _, prefix := range prefixes {
+		if strings.HasPrefix(llm, prefix) {
+			return providerFactories[providerPrefixes[prefix]], llm, nil
+		}
+	}
+
+	return nil, "", fmt.Errorf("no provider registered for llm %q", llm)
+}
+
+// configuredProvider is a provider whose responses also depend on settings it
+// holds rather than the request, such as Anthropic's default temperature or a
+// local server's base URL.
+type configuredProvider interface {
+	Settings() map[string]interface{}
+}
+
+// providerSettings returns the settings of a provider, or nil when it has
+// none.
+func providerSettings(p Provider) map[string]interface{} {
+	if c, ok := p.(configuredProvider); ok {
+		return c.Settings()
+	}
+	return nil
+}
+
+// requestHash identifies a request by its content and the provider settings
+// in effect so responses can be matched across runs.
+func requestHash(provider string, settings map[string]interface{}, req CompletionRequest) string {
+	payload, _ := json.Marshal(struct {
+		Provider string                 `json:"provider"`
+		Settings map[string]interface{} `json:"settings,omitempty"`
+		Request  CompletionRequest      `json:"request"`
+	}{provider, settings, req})
+
+	sum := sha256.Sum256(payload)
+	return hex.EncodeToString(sum[:])
+}
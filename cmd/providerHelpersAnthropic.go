@@ -0,0 +1,235 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+const (
+	anthropicBaseURL    = "https://api.anthropic.com"
+	anthropicAPIVersion = "2023-06-01"
+	anthropicMaxTokens  = 1200
+)
+
+type Anthropic struct {
+	client  *http.Client
+	baseURL string
+	apiKey  string
+	llm     string
+
+	maxTokens     int
+	temperature   *float64
+	stopSequences []string
+}
+
+type anthropicMessage struct {
+	Role    string `json:"role"`
+	Content string `json:"content"`
+}
+
+type anthropicMessagesRequest struct {
+	Model         string             `json:"model"`
+	MaxTokens     int                `json:"max_tokens"`
+	System        string             `json:"system,omitempty"`
+	Messages      []anthropicMessage `json:"messages"`
+	Temperature   *float64           `json:"temperature,omitempty"`
+	TopP          *float64           `json:"top_p,omitempty"`
+	StopSequences []string           `json:"stop_sequences,omitempty"`
+}
+
+type anthropicMessagesResponse struct {
+	Model   string `json:"model"`
+	Content []struct {
+		Type string `json:"type"`
+		Text string `json:"text"`
+	} `json:"content"`
+	StopReason string `json:"stop_reason"`
+	Usage      struct {
+		InputTokens  int `json:"input_tokens"`
+		OutputTokens int `json:"output_tokens"`
+	} `json:"usage"`
+}
+
+type anthropicErrorResponse struct {
+	Error struct {
+		Type    string `json:"type"`
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+func newAnthropic(llm string) (Provider, error) {
+	var anthropicObj Anthropic
+
+	ANTHROPIC_API_KEY := os.Getenv("ANTHROPIC_API_KEY")
+	if ANTHROPIC_API_KEY == "" {
+		return nil, errors.New("to use Anthropic (Claude) services you need to have the `ANTHROPIC_API_KEY` environment variable set")
+	}
+
+	anthropicObj.client = &http.Client{}
+	anthropicObj.baseURL = anthropicBaseURL
+	anthropicObj.apiKey = ANTHROPIC_API_KEY
+	anthropicObj.llm = llm
+	anthropicObj.maxTokens = anthropicMaxTokens
+
+	if baseURL := viper.GetString("anthropic.baseUrl"); baseURL != "" {
+		anthropicObj.baseURL = strings.TrimRight(baseURL, "/")
+	}
+	if viper.IsSet("anthropic.maxTokens") {
+		anthropicObj.maxTokens = viper.GetInt("anthropic.maxTokens")
+	}
+	if viper.IsSet("anthropic.temperature") {
+		temperature := viper.GetFloat64("anthropic.temperature")
+		anthropicObj.temperature = &temperature
+	}
+	anthropicObj.stopSequences = viper.GetStringSlice("anthropic.stopSequences")
+
+	return &anthropicObj, nil
+}
+
+func (a *Anthropic) Name() string {
+	return "anthropic"
+}
+
+func (a *Anthropic) Model() string {
+	return a.llm
+}
+
+func (a *Anthropic) Settings() map[string]interface{} {
+	settings := map[string]interface{}{
+		"baseUrl":   a.baseURL,
+		"maxTokens": a.maxTokens,
+	}
+	if a.temperature != nil {
+		settings["temperature"] = *a.temperature
+	}
+	if len(a.stopSequences) > 0 {
+		settings["stopSequences"] = a.stopSequences
+	}
+	return settings
+}
+
+func (a *Anthropic) Complete(ctx context.Context, req CompletionRequest) (*CompletionResponse, error) {
+	start := time.Now()
+
+	var messages []anthropicMessage
+	for _, message := range req.Messages {
+		messages = append(messages, anthropicMessage{Role: message.Role, Content: message.Content})
+	}
+	messages = append(messages, anthropicMessage{Role: "user", Content: req.Prompt})
+
+	body := anthropicMessagesRequest{
+		Model:         req.Model,
+		MaxTokens:     a.maxTokens,
+		System:        req.System,
+		Messages:      messages,
+		Temperature:   a.temperature,
+		StopSequences: a.stopSequences,
+	}
+
+	// the models section takes precedence over the anthropic section; the
+	// Messages API has no seed
+	if p := req.Params; p != nil {
+		if p.Temperature != nil {
+			body.Temperature = p.Temperature
+		}
+		if p.MaxTokens != nil {
+			body.MaxTokens = *p.MaxTokens
+		}
+		if p.Stop != nil {
+			body.StopSequences = p.Stop
+		}
+		body.TopP = p.TopP
+	}
+
+	// there is no native JSON mode, so prefill the reply with an open brace
+	var prefill string
+	if req.ResponseFormat == "json" {
+		prefill = "{"
+		body.Messages = append(body.Messages, anthropicMessage{Role: "assistant", Content: prefill})
+	}
+
+	resp, err := GetClaudeResponse(ctx, a, body)
+	if err != nil {
+		return nil, err
+	}
+
+	var content strings.Builder
+	content.WriteString(prefill)
+	for _, block := range resp.Content {
+		if block.Type == "text" {
+			content.WriteString(block.Text)
+		}
+	}
+
+	return &CompletionResponse{
+		Content: content.String(),
+		Model:   resp.Model,
+		Usage: Usage{
+			PromptTokens:     resp.Usage.InputTokens,
+			CompletionTokens: resp.Usage.OutputTokens,
+			TotalTokens:      resp.Usage.InputTokens + resp.Usage.OutputTokens,
+		},
+		Latency: time.Since(start),
+	}, nil
+}
+
+func GetClaudeResponse(ctx context.Context, a *Anthropic, body anthropicMessagesRequest) (*anthropicMessagesResponse, error) {
+	payload, err := json.Marshal(body)
+	if err != nil {
+		return nil, err
+	}
+
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, a.baseURL+"/v1/messages", bytes.NewReader(payload))
+	if err != nil {
+		return nil, err
+	}
+	httpReq.Header.Set("content-type", "application/json")
+	httpReq.Header.Set("x-api-key", a.apiKey)
+	httpReq.Header.Set("anthropic-version", anthropicAPIVersion)
+
+	httpResp, err := a.client.Do(httpReq)
+	if err != nil {
+		return nil, err
+	}
+	defer httpResp.Body.Close()
+
+	data, err := io.ReadAll(httpResp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	// 529 is returned when the API is overloaded and is safe to retry
+	if httpResp.StatusCode == http.StatusTooManyRequests || httpResp.StatusCode == 529 {
+		retryAfter := ParseRateLimitError(string(data))
+		if seconds, err := strconv.Atoi(httpResp.Header.Get("retry-after")); err == nil {
+			retryAfter = time.Duration(seconds) * time.Second
+		}
+		return nil, &RateLimitError{retryAfter}
+	}
+
+	if httpResp.StatusCode != http.StatusOK {
+		var errResp anthropicErrorResponse
+		if err := json.Unmarshal(data, &errResp); err == nil && errResp.Error.Message != "" {
+			return nil, fmt.Errorf("anthropic: %s: %s", errResp.Error.Type, errResp.Error.Message)
+		}
+		return nil, fmt.Errorf("anthropic: unexpected status %s", httpResp.Status)
+	}
+
+	var resp anthropicMessagesResponse
+	if err := json.Unmarshal(data, &resp); err != nil {
+		return nil, err
+	}
+
+	return &resp, nil
+}
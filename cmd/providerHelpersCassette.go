@@ -0,0 +1,188 @@
+package cmd
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+// cassetteEntry is a single recorded interaction, stored one per line in a
+// cassette file.
+type cassetteEntry struct {
+	Hash       string                 `json:"hash"`
+	LLM        string                 `json:"llm"`
+	Provider   string                 `json:"provider"`
+	Model      string                 `json:"model"`
+	Settings   map[string]interface{} `json:"settings,omitempty"`
+	Request    CompletionRequest      `json:"request"`
+	Response   CompletionResponse     `json:"response"`
+	RecordedAt time.Time              `json:"recordedAt"`
+}
+
+type cassetteRecorder struct {
+	mu   sync.Mutex
+	file *os.File
+}
+
+type cassette struct {
+	mu      sync.Mutex
+	path    string
+	entries map[string][]cassetteEntry
+	served  map[string]int
+	llms    map[string]cassetteEntry
+}
+
+// recordingProvider writes every successful interaction of the wrapped
+// provider to a cassette file.
+type recordingProvider struct {
+	Provider
+	llm      string
+	recorder *cassetteRecorder
+}
+
+// replayingProvider serves responses from a cassette. On a miss it either
+// fails or, when fallthrough is enabled and a live provider exists, calls it.
+// Without a live provider the recorded settings are hashed.
+type replayingProvider struct {
+	live     Provider
+	name     string
+	model    string
+	settings map[string]interface{}
+	llm      string
+	cassette *cassette
+}
+
+func newCassetteRecorder(path string) (*cassetteRecorder, error) {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, err
+	}
+	return &cassetteRecorder{file: file}, nil
+}
+
+func (r *cassetteRecorder) record(entry cassetteEntry) error {
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	_, err = r.file.Write(append(line, '\n'))
+	return err
+}
+
+func (r *cassetteRecorder) Close() error {
+	return r.file.Close()
+}
+
+func loadCassette(path string) (*cassette, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	c := cassette{
+		path:    path,
+		entries: make(map[string][]cassetteEntry),
+		served:  make(map[string]int),
+		llms:    make(map[string]cassetteEntry),
+	}
+
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 1024*1024), 64*1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+
+		var entry cassetteEntry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			return nil, fmt.Errorf("%s:%d: %w", path, line, err)
+		}
+
+		c.entries[entry.Hash] = append(c.entries[entry.Hash], entry)
+		c.llms[entry.LLM] = entry
+	}
+
+	return &c, scanner.Err()
+}
+
+// next returns the recorded response for a hash. Identical requests recorded
+// several times are served in recording order, repeating the last one.
+func (c *cassette) next(hash string) (*CompletionResponse, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entries, ok := c.entries[hash]
+	if !ok {
+		return nil, false
+	}
+
+	i := c.served[hash]
+	if i >= len(entries) {
+		i = len(entries) - 1
+	}
+	c.served[hash]++
+
+	response := entries[i].Response
+	return &response, true
+}
+
+func (p *recordingProvider) Settings() map[string]interface{} {
+	return providerSettings(p.Provider)
+}
+
+func (p *recordingProvider) Complete(ctx context.Context, req CompletionRequest) (*CompletionResponse, error) {
+	resp, err := p.Provider.Complete(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+
+	err = p.recorder.record(cassetteEntry{
+		Hash:       requestHash(p.Name(), p.Settings(), req),
+		LLM:        p.llm,
+		Provider:   p.Name(),
+		Model:      p.Model(),
+		Settings:   p.Settings(),
+		Request:    req,
+		Response:   *resp,
+		RecordedAt: time.Now(),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("record: %w", err)
+	}
+
+	return resp, nil
+}
+
+func (p *replayingProvider) Name() string {
+	return p.name
+}
+
+func (p *replayingProvider) Model() string {
+	return p.model
+}
+
+func (p *replayingProvider) Settings() map[string]interface{} {
+	return p.settings
+}
+
+func (p *replayingProvider) Complete(ctx context.Context, req CompletionRequest) (*CompletionResponse, error) {
+	hash := requestHash(p.name, p.settings, req)
+	if resp, ok := p.cassette.next(hash); ok {
+		return resp, nil
+	}
+
+	if p.live != nil {
+		return p.live.Complete(ctx, req)
+	}
+
+	return nil, fmt.Errorf("replay: no response recorded in %s for %s (%s), request hash %s", p.cassette.path, p.llm, p.name, hash)
+}
@@ -0,0 +1,106 @@
+package cmd
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// recordCassette records the given prompts, in order, through a mock whose
+// script answers "first", "second", "first", ... and returns the cassette.
+func recordCassette(t *testing.T, prompts ...string) *cassette {
+	t.Helper()
+	dir := t.TempDir()
+
+	script := filepath.Join(dir, "script.yaml")
+	err := os.WriteFile(script, []byte("steps:\n  - response: first\n  - response: second\n"), 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mock, err := newMock("script=" + script)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	path := filepath.Join(dir, "cassette.jsonl")
+	recorder, err := newCassetteRecorder(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	provider := &recordingProvider{mock, "mock:script", recorder}
+	for _, prompt := range prompts {
+		if _, err := provider.Complete(context.Background(), CompletionRequest{Model: "mock:script=x", Prompt: prompt}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := recorder.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	c, err := loadCassette(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+func TestCassetteReplay(t *testing.T) {
+	c := recordCassette(t, "a", "a", "b")
+	replay := &replayingProvider{name: "mock", model: "mock:script=x", llm: "mock:script", cassette: c}
+
+	// identical requests are served in recording order, repeating the last
+	for _, tt := range []struct{ prompt, want string }{
+		{"a", "first"},
+		{"a", "second"},
+		{"b", "first"},
+		{"a", "second"},
+	} {
+		resp, err := replay.Complete(context.Background(), CompletionRequest{Model: "mock:script=x", Prompt: tt.prompt})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resp.Content != tt.want {
+			t.Errorf("replay of %q = %q, want %q", tt.prompt, resp.Content, tt.want)
+		}
+	}
+}
+
+func TestCassetteMiss(t *testing.T) {
+	c := recordCassette(t, "a")
+
+	// the recorded model is part of the request, so another model misses too
+	for _, req := range []CompletionRequest{
+		{Model: "mock:script=x", Prompt: "c"},
+		{Model: "mock:other", Prompt: "a"},
+	} {
+		replay := &replayingProvider{name: "mock", model: req.Model, llm: "mock:script", cassette: c}
+		_, err := replay.Complete(context.Background(), req)
+		if err == nil || !strings.Contains(err.Error(), "no response recorded") {
+			t.Errorf("replay of %+v: error = %v, want a miss", req, err)
+		}
+	}
+}
+
+func TestCassetteFallthrough(t *testing.T) {
+	c := recordCassette(t, "a")
+	live, err := newMock("always-true")
+	if err != nil {
+		t.Fatal(err)
+	}
+	replay := &replayingProvider{live: live, name: "mock", model: "mock:script=x", llm: "mock:script", cassette: c}
+
+	for _, tt := range []struct{ prompt, want string }{
+		{"a", "first"},
+		{"c", "true"},
+	} {
+		resp, err := replay.Complete(context.Background(), CompletionRequest{Model: "mock:script=x", Prompt: tt.prompt})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resp.Content != tt.want {
+			t.Errorf("replay of %q = %q, want %q", tt.prompt, resp.Content, tt.want)
+		}
+	}
+}
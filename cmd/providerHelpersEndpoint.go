@@ -0,0 +1,131 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/sashabaranov/go-openai"
+	"github.com/spf13/viper"
+)
+
+// Endpoint is an OpenAI chat-completions compatible API configured under the
+// endpoints section of the config, e.g. vLLM, LiteLLM, Azure OpenAI or an
+// internal gateway. It is referenced from --llms as "<endpoint>:<model>".
+type Endpoint struct {
+	*OpenAi
+	name    string
+	baseURL string
+	aliases map[string]string
+}
+
+// headerTransport adds the configured headers and query parameters to every
+// request sent to an endpoint.
+type headerTransport struct {
+	base    http.RoundTripper
+	headers map[string]string
+	query   map[string]string
+}
+
+func (t *headerTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	req = req.Clone(req.Context())
+	for key, value := range t.headers {
+		req.Header.Set(key, value)
+	}
+	if len(t.query) > 0 {
+		q := req.URL.Query()
+		for key, value := range t.query {
+			q.Set(key, value)
+		}
+		req.URL.RawQuery = q.Encode()
+	}
+	return t.base.RoundTrip(req)
+}
+
+// registerEndpoints adds every entry of the endpoints config section to the
+// provider registry. An endpoint may not take the name of another provider.
+func registerEndpoints() error {
+	for name := range viper.GetStringMap("endpoints") {
+		if _, ok := providerFactories[name]; ok {
+			return fmt.Errorf("endpoint %q has the name of a registered provider", name)
+		}
+		RegisterProvider(name, newEndpointFactory(name))
+	}
+	return nil
+}
+
+func newEndpointFactory(name string) ProviderFactory {
+	return func(llm string) (Provider, error) {
+		key := "endpoints." + name
+
+		baseURL := viper.GetString(key + ".baseUrl")
+		if baseURL == "" {
+			return nil, fmt.Errorf("endpoint %q needs a baseUrl", name)
+		}
+
+		var apiKey string
+		if apiKeyEnv := viper.GetString(key + ".apiKeyEnv"); apiKeyEnv != "" {
+			apiKey = os.Getenv(apiKeyEnv)
+			if apiKey == "" {
+				return nil, fmt.Errorf("to use the %q endpoint you need to have the `%s` environment variable set", name, apiKeyEnv)
+			}
+		}
+
+		var config openai.ClientConfig
+		apiVersion := viper.GetString(key + ".apiVersion")
+		transport := &headerTransport{base: http.DefaultTransport, headers: map[string]string{}, query: map[string]string{}}
+
+		switch strings.ToLower(viper.GetString(key + ".type")) {
+		case "azure":
+			config = openai.DefaultAzureConfig(apiKey, baseURL)
+			if apiVersion != "" {
+				config.APIVersion = apiVersion
+			}
+			// model aliases already resolve to deployment names
+			config.AzureModelMapperFunc = func(model string) string { return model }
+		case "", "openai":
+			config = openai.DefaultConfig(apiKey)
+			config.BaseURL = strings.TrimRight(baseURL, "/")
+			if apiVersion != "" {
+				transport.query["api-version"] = apiVersion
+			}
+		default:
+			return nil, fmt.Errorf("endpoint %q has unknown type %q", name, viper.GetString(key+".type"))
+		}
+
+		for header, value := range viper.GetStringMapString(key + ".headers") {
+			transport.headers[header] = os.ExpandEnv(value)
+		}
+		config.HTTPClient = &http.Client{Transport: transport}
+
+		return &Endpoint{
+			OpenAi:  &OpenAi{client: openai.NewClientWithConfig(config), llm: llm},
+			name:    name,
+			baseURL: strings.TrimRight(baseURL, "/"),
+			aliases: viper.GetStringMapString(key + ".models"),
+		}, nil
+	}
+}
+
+func (e *Endpoint) Name() string {
+	return e.name
+}
+
+// Settings includes the model an alias resolves to, so that cached and
+// recorded responses change when the alias is pointed elsewhere.
+func (e *Endpoint) Settings() map[string]interface{} {
+	settings := map[string]interface{}{"baseUrl": e.baseURL}
+	if model, ok := e.aliases[strings.ToLower(e.Model())]; ok {
+		settings["model"] = model
+	}
+	return settings
+}
+
+func (e *Endpoint) Complete(ctx context.Context, req CompletionRequest) (*CompletionResponse, error) {
+	if model, ok := e.aliases[strings.ToLower(req.Model)]; ok {
+		req.Model = model
+	}
+	return e.OpenAi.Complete(ctx, req)
+}
@@ -0,0 +1,253 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+var localDefaultBaseURLs = map[string]string{
+	"ollama":   "http://localhost:11434",
+	"llamacpp": "http://localhost:8080",
+}
+
+// Local talks to a model served on the developer's machine, either through
+// Ollama's /api/chat endpoint or a llama.cpp server's chat completions.
+type Local struct {
+	client  *http.Client
+	baseURL string
+	flavor  string
+	llm     string
+}
+
+type localMessage struct {
+	Role    string `json:"role"`
+	Content string `json:"content"`
+}
+
+type ollamaChatRequest struct {
+	Model    string                 `json:"model"`
+	Messages []localMessage         `json:"messages"`
+	Stream   bool                   `json:"stream"`
+	Format   string                 `json:"format,omitempty"`
+	Options  map[string]interface{} `json:"options,omitempty"`
+}
+
+type ollamaChatResponse struct {
+	Model           string       `json:"model"`
+	Message         localMessage `json:"message"`
+	PromptEvalCount int          `json:"prompt_eval_count"`
+	EvalCount       int          `json:"eval_count"`
+	Error           string       `json:"error"`
+}
+
+type llamaCppChatRequest struct {
+	Model          string            `json:"model,omitempty"`
+	Messages       []localMessage    `json:"messages"`
+	Stream         bool              `json:"stream"`
+	ResponseFormat map[string]string `json:"response_format,omitempty"`
+	Temperature    *float64          `json:"temperature,omitempty"`
+	TopP           *float64          `json:"top_p,omitempty"`
+	MaxTokens      *int              `json:"max_tokens,omitempty"`
+	Seed           *int              `json:"seed,omitempty"`
+	Stop           []string          `json:"stop,omitempty"`
+}
+
+type llamaCppChatResponse struct {
+	Model   string `json:"model"`
+	Choices []struct {
+		Message localMessage `json:"message"`
+	} `json:"choices"`
+	Usage struct {
+		PromptTokens     int `json:"prompt_tokens"`
+		CompletionTokens int `json:"completion_tokens"`
+		TotalTokens      int `json:"total_tokens"`
+	} `json:"usage"`
+}
+
+func newLocalFactory(flavor string) ProviderFactory {
+	return func(llm string) (Provider, error) {
+		baseURL := viper.GetString("localLLMs." + flavor + ".baseUrl")
+		if baseURL == "" {
+			baseURL = localDefaultBaseURLs[flavor]
+		}
+
+		client := &http.Client{}
+		if timeout := viper.GetString("localLLMs." + flavor + ".timeout"); timeout != "" {
+			d, err := time.ParseDuration(timeout)
+			if err != nil {
+				return nil, fmt.Errorf("invalid localLLMs.%s.timeout: %w", flavor, err)
+			}
+			client.Timeout = d
+		}
+
+		return newLocal(flavor, baseURL, client, llm), nil
+	}
+}
+
+func newLocal(flavor, baseURL string, client *http.Client, llm string) *Local {
+	return &Local{
+		client:  client,
+		baseURL: strings.TrimRight(baseURL, "/"),
+		flavor:  flavor,
+		llm:     llm,
+	}
+}
+
+func (l *Local) Name() string {
+	return l.flavor
+}
+
+func (l *Local) Model() string {
+	return l.llm
+}
+
+func (l *Local) Settings() map[string]interface{} {
+	return map[string]interface{}{"baseUrl": l.baseURL}
+}
+
+func (l *Local) Complete(ctx context.Context, req CompletionRequest) (*CompletionResponse, error) {
+	start := time.Now()
+
+	var messages []localMessage
+	if req.System != "" {
+		messages = append(messages, localMessage{Role: "system", Content: req.System})
+	}
+	for _, message := range req.Messages {
+		messages = append(messages, localMessage{Role: message.Role, Content: message.Content})
+	}
+	messages = append(messages, localMessage{Role: "user", Content: req.Prompt})
+
+	var completion *CompletionResponse
+	var err error
+	if l.flavor == "ollama" {
+		completion, err = l.completeOllama(ctx, req, messages)
+	} else {
+		completion, err = l.completeLlamaCpp(ctx, req, messages)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	completion.Latency = time.Since(start)
+	return completion, nil
+}
+
+func (l *Local) completeOllama(ctx context.Context, req CompletionRequest, messages []localMessage) (*CompletionResponse, error) {
+	body := ollamaChatRequest{Model: req.Model, Messages: messages}
+	if req.ResponseFormat == "json" {
+		body.Format = "json"
+	}
+	if p := req.Params; p != nil {
+		body.Options = make(map[string]interface{})
+		if p.Temperature != nil {
+			body.Options["temperature"] = *p.Temperature
+		}
+		if p.TopP != nil {
+			body.Options["top_p"] = *p.TopP
+		}
+		if p.MaxTokens != nil {
+			body.Options["num_predict"] = *p.MaxTokens
+		}
+		if p.Seed != nil {
+			body.Options["seed"] = *p.Seed
+		}
+		if p.Stop != nil {
+			body.Options["stop"] = p.Stop
+		}
+	}
+
+	var resp ollamaChatResponse
+	err := l.post(ctx, "/api/chat", body, &resp)
+	if err != nil {
+		return nil, err
+	}
+	if resp.Error != "" {
+		return nil, fmt.Errorf("ollama: %s", resp.Error)
+	}
+
+	return &CompletionResponse{
+		Content: resp.Message.Content,
+		Model:   resp.Model,
+		Usage: Usage{
+			PromptTokens:     resp.PromptEvalCount,
+			CompletionTokens: resp.EvalCount,
+			TotalTokens:      resp.PromptEvalCount + resp.EvalCount,
+		},
+	}, nil
+}
+
+func (l *Local) completeLlamaCpp(ctx context.Context, req CompletionRequest, messages []localMessage) (*CompletionResponse, error) {
+	body := llamaCppChatRequest{Model: req.Model, Messages: messages}
+	if req.ResponseFormat == "json" {
+		body.ResponseFormat = map[string]string{"type": "json_object"}
+	}
+	if p := req.Params; p != nil {
+		body.Temperature = p.Temperature
+		body.TopP = p.TopP
+		body.MaxTokens = p.MaxTokens
+		body.Seed = p.Seed
+		body.Stop = p.Stop
+	}
+
+	var resp llamaCppChatResponse
+	err := l.post(ctx, "/v1/chat/completions", body, &resp)
+	if err != nil {
+		return nil, err
+	}
+	if len(resp.Choices) == 0 {
+		return nil, fmt.Errorf("llamacpp: response contained no choices")
+	}
+
+	return &CompletionResponse{
+		Content: resp.Choices[0].Message.Content,
+		Model:   req.Model,
+		Usage: Usage{
+			PromptTokens:     resp.Usage.PromptTokens,
+			CompletionTokens: resp.Usage.CompletionTokens,
+			TotalTokens:      resp.Usage.TotalTokens,
+		},
+	}, nil
+}
+
+func (l *Local) post(ctx context.Context, path string, body interface{}, out interface{}) error {
+	payload, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, l.baseURL+path, bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	httpReq.Header.Set("content-type", "application/json")
+
+	httpResp, err := l.client.Do(httpReq)
+	if err != nil {
+		return err
+	}
+	defer httpResp.Body.Close()
+
+	data, err := io.ReadAll(httpResp.Body)
+	if err != nil {
+		return err
+	}
+
+	// llama.cpp answers 503 while all of its slots are busy
+	if httpResp.StatusCode == http.StatusTooManyRequests || httpResp.StatusCode == http.StatusServiceUnavailable {
+		return &RateLimitError{ParseRateLimitError(string(data))}
+	}
+
+	if httpResp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s: unexpected status %s: %s", l.flavor, httpResp.Status, strings.TrimSpace(string(data)))
+	}
+
+	return json.Unmarshal(data, out)
+}
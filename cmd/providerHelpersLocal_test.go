@@ -0,0 +1,140 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestLocalOllama(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/chat" {
+			t.Errorf("path = %s, want /api/chat", r.URL.Path)
+		}
+
+		var body ollamaChatRequest
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			t.Fatal(err)
+		}
+		if body.Model != "llama3" || body.Stream || body.Format != "json" {
+			t.Errorf("request = %+v", body)
+		}
+		if len(body.Messages) != 2 || body.Messages[0].Role != "system" || body.Messages[1].Content != "is this safe?" {
+			t.Errorf("messages = %+v", body.Messages)
+		}
+		if body.Options["temperature"] != 0.2 || body.Options["num_predict"] != float64(64) {
+			t.Errorf("options = %v", body.Options)
+		}
+
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"model":             "llama3",
+			"message":           map[string]string{"role": "assistant", "content": "true"},
+			"prompt_eval_count": 12,
+			"eval_count":        3,
+		})
+	}))
+	defer server.Close()
+
+	temperature, maxTokens := 0.2, 64
+	local := newLocal("ollama", server.URL+"/", server.Client(), "llama3")
+	resp, err := local.Complete(context.Background(), CompletionRequest{
+		Model:          "llama3",
+		System:         "you review diffs",
+		Prompt:         "is this safe?",
+		ResponseFormat: "json",
+		Params:         &GenerationParams{Temperature: &temperature, MaxTokens: &maxTokens},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Content != "true" || resp.Model != "llama3" {
+		t.Errorf("response = %+v", resp)
+	}
+	if resp.Usage != (Usage{PromptTokens: 12, CompletionTokens: 3, TotalTokens: 15}) {
+		t.Errorf("usage = %+v", resp.Usage)
+	}
+}
+
+func TestLocalLlamaCpp(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/chat/completions" {
+			t.Errorf("path = %s, want /v1/chat/completions", r.URL.Path)
+		}
+
+		var body llamaCppChatRequest
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			t.Fatal(err)
+		}
+		if body.ResponseFormat["type"] != "json_object" || body.MaxTokens == nil || *body.MaxTokens != 64 {
+			t.Errorf("request = %+v", body)
+		}
+		if len(body.Messages) != 1 || body.Messages[0].Role != "user" {
+			t.Errorf("messages = %+v", body.Messages)
+		}
+
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"choices": []interface{}{map[string]interface{}{"message": map[string]string{"role": "assistant", "content": "false"}}},
+			"usage":   map[string]int{"prompt_tokens": 8, "completion_tokens": 1, "total_tokens": 9},
+		})
+	}))
+	defer server.Close()
+
+	maxTokens := 64
+	local := newLocal("llamacpp", server.URL, server.Client(), "qwen")
+	resp, err := local.Complete(context.Background(), CompletionRequest{
+		Model:          "qwen",
+		Prompt:         "is this safe?",
+		ResponseFormat: "json",
+		Params:         &GenerationParams{MaxTokens: &maxTokens},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Content != "false" || resp.Model != "qwen" {
+		t.Errorf("response = %+v", resp)
+	}
+	if resp.Usage != (Usage{PromptTokens: 8, CompletionTokens: 1, TotalTokens: 9}) {
+		t.Errorf("usage = %+v", resp.Usage)
+	}
+}
+
+func TestLocalErrors(t *testing.T) {
+	tests := []struct {
+		name      string
+		flavor    string
+		status    int
+		body      string
+		rateLimit bool
+	}{
+		{"ollama busy", "ollama", http.StatusServiceUnavailable, "busy", true},
+		{"llamacpp busy", "llamacpp", http.StatusServiceUnavailable, `{"error":"no slot available"}`, true},
+		{"llamacpp too many requests", "llamacpp", http.StatusTooManyRequests, "", true},
+		{"ollama server error", "ollama", http.StatusInternalServerError, "boom", false},
+		{"ollama error field", "ollama", http.StatusOK, `{"error":"model not found"}`, false},
+		{"llamacpp no choices", "llamacpp", http.StatusOK, `{"choices":[]}`, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(tt.status)
+				w.Write([]byte(tt.body))
+			}))
+			defer server.Close()
+
+			local := newLocal(tt.flavor, server.URL, server.Client(), "model")
+			_, err := local.Complete(context.Background(), CompletionRequest{Model: "model", Prompt: "hi"})
+			if err == nil {
+				t.Fatal("expected an error")
+			}
+
+			var rateLimitError *RateLimitError
+			if errors.As(err, &rateLimitError) != tt.rateLimit {
+				t.Errorf("error = %v, rate limit %v", err, tt.rateLimit)
+			}
+		})
+	}
+}
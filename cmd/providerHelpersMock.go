@@ -0,0 +1,348 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"math/rand"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+// Mock is an offline provider returning configurable verdicts, used for dry
+// runs and pipeline testing. Supported forms are:
+//
+//	mock:always-true, mock:always-false, mock:always-inconclusive
+//	mock:echo-label
+//	mock:random?seed=1&accuracy=0.8
+//	mock:script=file.yaml
+//
+// Every form also accepts latency, errorRate, rateLimitRate and retryAfter
+// query parameters. Randomness is derived from the seed, the prompt and the
+// attempt number so runs are reproducible regardless of scheduling.
+type Mock struct {
+	llm  string
+	mode string
+
+	seed          int64
+	accuracy      float64
+	latency       time.Duration
+	errorRate     float64
+	rateLimitRate float64
+	retryAfter    time.Duration
+
+	script *mockScript
+
+	mu       sync.Mutex
+	attempts map[string]int
+	calls    int
+}
+
+type mockStep struct {
+	Match      string `mapstructure:"match"`
+	Response   string `mapstructure:"response"`
+	Latency    string `mapstructure:"latency"`
+	Error      string `mapstructure:"error"`
+	RetryAfter string `mapstructure:"retryAfter"`
+
+	pattern    *regexp.Regexp
+	latency    time.Duration
+	retryAfter time.Duration
+}
+
+type mockScript struct {
+	rules []mockStep
+	steps []mockStep
+}
+
+func newMock(llm string) (Provider, error) {
+	mode, rawQuery, _ := strings.Cut(llm, "?")
+	query, err := url.ParseQuery(rawQuery)
+	if err != nil {
+		return nil, fmt.Errorf("mock: invalid options %q: %w", rawQuery, err)
+	}
+
+	mockObj := Mock{
+		llm:        "mock:" + llm,
+		mode:       mode,
+		accuracy:   1,
+		retryAfter: 10 * time.Millisecond,
+		attempts:   make(map[string]int),
+	}
+
+	if mockObj.seed, err = mockInt(query, "seed"); err != nil {
+		return nil, err
+	}
+	if mockObj.accuracy, err = mockFloat(query, "accuracy", mockObj.accuracy); err != nil {
+		return nil, err
+	}
+	if mockObj.errorRate, err = mockFloat(query, "errorRate", 0); err != nil {
+		return nil, err
+	}
+	if mockObj.rateLimitRate, err = mockFloat(query, "rateLimitRate", 0); err != nil {
+		return nil, err
+	}
+	if mockObj.latency, err = mockDuration(query, "latency", 0); err != nil {
+		return nil, err
+	}
+	if mockObj.retryAfter, err = mockDuration(query, "retryAfter", mockObj.retryAfter); err != nil {
+		return nil, err
+	}
+
+	switch {
+	case strings.HasPrefix(mode, "script="):
+		mockObj.mode = "script"
+		mockObj.script, err = loadMockScript(strings.TrimPrefix(mode, "script="))
+		if err != nil {
+			return nil, err
+		}
+	case mode == "always-true", mode == "always-false", mode == "always-inconclusive", mode == "echo-label", mode == "random":
+	default:
+		return nil, fmt.Errorf("mock: unknown mode %q", mode)
+	}
+
+	return &mockObj, nil
+}
+
+func loadMockScript(path string) (*mockScript, error) {
+	v := viper.New()
+	v.SetConfigFile(path)
+	if err := v.ReadInConfig(); err != nil {
+		return nil, fmt.Errorf("mock: reading script: %w", err)
+	}
+
+	var steps []mockStep
+	err := v.UnmarshalKey("steps", &steps)
+	if err != nil {
+		return nil, fmt.Errorf("mock: parsing script: %w", err)
+	}
+
+	var script mockScript
+	for _, step := range steps {
+		if step.Latency != "" {
+			if step.latency, err = time.ParseDuration(step.Latency); err != nil {
+				return nil, fmt.Errorf("mock: invalid latency %q: %w", step.Latency, err)
+			}
+		}
+		if step.RetryAfter != "" {
+			if step.retryAfter, err = time.ParseDuration(step.RetryAfter); err != nil {
+				return nil, fmt.Errorf("mock: invalid retryAfter %q: %w", step.RetryAfter, err)
+			}
+		}
+
+		if step.Match == "" {
+			script.steps = append(script.steps, step)
+			continue
+		}
+
+		pattern, err := regexp.Compile(step.Match)
+		if err != nil {
+			return nil, fmt.Errorf("mock: invalid match %q: %w", step.Match, err)
+		}
+		step.pattern = pattern
+		script.rules = append(script.rules, step)
+	}
+
+	if len(script.steps) == 0 && len(script.rules) == 0 {
+		return nil, fmt.Errorf("mock: script %s has no steps", path)
+	}
+
+	return &script, nil
+}
+
+func (m *Mock) Name() string {
+	return "mock"
+}
+
+func (m *Mock) Model() string {
+	return m.llm
+}
+
+func (m *Mock) Complete(ctx context.Context, req CompletionRequest) (*CompletionResponse, error) {
+	start := time.Now()
+
+	m.mu.Lock()
+	key := req.System + "\x00" + req.Prompt
+	if req.Sample > 0 {
+		key += "\x00" + strconv.Itoa(req.Sample)
+	}
+	attempt := m.attempts[key]
+	m.attempts[key]++
+	call := m.calls
+	m.calls++
+	m.mu.Unlock()
+
+	rng := m.rand(key, attempt)
+
+	latency := m.latency
+	var content string
+	var stepErr error
+
+	switch m.mode {
+	case "always-true":
+		content = "true"
+	case "always-false":
+		content = "false"
+	case "always-inconclusive":
+		content = "I am unable to determine whether this test passes."
+	case "echo-label":
+		content = req.Expected
+	case "random":
+		content = m.randomVerdict(rng, req.Expected)
+	case "script":
+		step := m.script.pick(req.Prompt, call)
+		content = step.Response
+		if step.Latency != "" {
+			latency = step.latency
+		}
+		stepErr = m.stepError(step)
+	}
+
+	if err := mockSleep(ctx, latency); err != nil {
+		return nil, err
+	}
+
+	if stepErr != nil {
+		return nil, stepErr
+	}
+	if roll := rng.Float64(); roll < m.rateLimitRate {
+		return nil, &RateLimitError{m.retryAfter}
+	} else if roll < m.rateLimitRate+m.errorRate {
+		return nil, errors.New("mock: simulated provider error")
+	}
+
+	return &CompletionResponse{
+		Content: content,
+		Model:   m.llm,
+		Usage: Usage{
+			PromptTokens:     len(req.Prompt) / 4,
+			CompletionTokens: len(content) / 4,
+			TotalTokens:      (len(req.Prompt) + len(content)) / 4,
+		},
+		Latency: time.Since(start),
+	}, nil
+}
+
+func (m *Mock) rand(key string, attempt int) *rand.Rand {
+	h := fnv.New64a()
+	fmt.Fprintf(h, "%d\x00%d\x00%s", m.seed, attempt, key)
+	return rand.New(rand.NewSource(int64(h.Sum64())))
+}
+
+func (m *Mock) randomVerdict(rng *rand.Rand, expected string) string {
+	if multiClass() {
+		return m.randomLabel(rng, expected)
+	}
+
+	verdict := rng.Intn(2) == 0
+	if expected != "" {
+		verdict = strings.ToLower(expected) == "true"
+		if rng.Float64() >= m.accuracy {
+			verdict = !verdict
+		}
+	}
+	return strconv.FormatBool(verdict)
+}
+
+// randomLabel answers the expected label with the configured accuracy, and
+// otherwise another of verdict.labels, or "unknown" if none are listed.
+func (m *Mock) randomLabel(rng *rand.Rand, expected string) string {
+	if rng.Float64() < m.accuracy {
+		return expected
+	}
+
+	var others []string
+	for _, label := range viper.GetStringSlice("verdict.labels") {
+		if normalizeVerdict(label) != expected {
+			others = append(others, label)
+		}
+	}
+	if len(others) == 0 {
+		return "unknown"
+	}
+	return others[rng.Intn(len(others))]
+}
+
+func (m *Mock) stepError(step mockStep) error {
+	switch step.Error {
+	case "":
+		return nil
+	case "rate_limit":
+		if step.RetryAfter != "" {
+			return &RateLimitError{step.retryAfter}
+		}
+		return &RateLimitError{m.retryAfter}
+	default:
+		return fmt.Errorf("mock: %s", step.Error)
+	}
+}
+
+// pick returns the first rule matching the prompt, otherwise cycles through
+// the unconditional steps in call order.
+func (s *mockScript) pick(prompt string, call int) mockStep {
+	for _, rule := range s.rules {
+		if rule.pattern.MatchString(prompt) {
+			return rule
+		}
+	}
+	if len(s.steps) == 0 {
+		return mockStep{}
+	}
+	return s.steps[call%len(s.steps)]
+}
+
+func mockSleep(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return nil
+	}
+
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+func mockInt(query url.Values, key string) (int64, error) {
+	if !query.Has(key) {
+		return 0, nil
+	}
+	v, err := strconv.ParseInt(query.Get(key), 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("mock: invalid %s: %w", key, err)
+	}
+	return v, nil
+}
+
+func mockFloat(query url.Values, key string, fallback float64) (float64, error) {
+	if !query.Has(key) {
+		return fallback, nil
+	}
+	v, err := strconv.ParseFloat(query.Get(key), 64)
+	if err != nil {
+		return 0, fmt.Errorf("mock: invalid %s: %w", key, err)
+	}
+	return v, nil
+}
+
+func mockDuration(query url.Values, key string, fallback time.Duration) (time.Duration, error) {
+	if !query.Has(key) {
+		return fallback, nil
+	}
+	v, err := time.ParseDuration(query.Get(key))
+	if err != nil {
+		return 0, fmt.Errorf("mock: invalid %s: %w", key, err)
+	}
+	return v, nil
+}
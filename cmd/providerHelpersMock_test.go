@@ -0,0 +1,193 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// mockComplete sends a prompt with an expected label to a mock.
+func mockComplete(t *testing.T, llm, prompt, expected string) (*CompletionResponse, error) {
+	t.Helper()
+	provider, err := newMock(llm)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return provider.Complete(context.Background(), CompletionRequest{Prompt: prompt, Expected: expected})
+}
+
+func TestMockModes(t *testing.T) {
+	tests := []struct {
+		llm      string
+		expected string
+		want     string
+	}{
+		{"always-true", "false", "true"},
+		{"always-false", "true", "false"},
+		{"always-inconclusive", "true", "I am unable to determine whether this test passes."},
+		{"echo-label", "false", "false"},
+		{"random?accuracy=1", "true", "true"},
+		{"random?accuracy=1", "false", "false"},
+		{"random?accuracy=0", "true", "false"},
+		{"random?accuracy=0", "false", "true"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.llm+"/"+tt.expected, func(t *testing.T) {
+			resp, err := mockComplete(t, tt.llm, "prompt", tt.expected)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if resp.Content != tt.want {
+				t.Errorf("Content = %q, want %q", resp.Content, tt.want)
+			}
+		})
+	}
+}
+
+func TestMockRandom(t *testing.T) {
+	verdicts := func(llm string) string {
+		provider, err := newMock(llm)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var b strings.Builder
+		for i := 0; i < 200; i++ {
+			resp, err := provider.Complete(context.Background(), CompletionRequest{Prompt: fmt.Sprint(i), Expected: "true"})
+			if err != nil {
+				t.Fatal(err)
+			}
+			b.WriteString(resp.Content[:1])
+		}
+		return b.String()
+	}
+
+	first := verdicts("random?seed=7&accuracy=0.8")
+	if again := verdicts("random?seed=7&accuracy=0.8"); again != first {
+		t.Error("the same seed gave different verdicts")
+	}
+	if other := verdicts("random?seed=8&accuracy=0.8"); other == first {
+		t.Error("another seed gave the same verdicts")
+	}
+
+	// 200 draws at 0.8 land within 4 standard deviations, about 23, of 160
+	if correct := strings.Count(first, "t"); correct < 137 || correct > 183 {
+		t.Errorf("%d of 200 verdicts correct at accuracy 0.8", correct)
+	}
+}
+
+func TestMockFailures(t *testing.T) {
+	tests := []struct {
+		llm       string
+		rateLimit time.Duration
+		err       bool
+	}{
+		{llm: "always-true?errorRate=1", err: true},
+		{llm: "always-true?rateLimitRate=1", rateLimit: 10 * time.Millisecond},
+		{llm: "always-true?rateLimitRate=1&retryAfter=2s", rateLimit: 2 * time.Second},
+		{llm: "always-true?errorRate=0&rateLimitRate=0"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.llm, func(t *testing.T) {
+			_, err := mockComplete(t, tt.llm, "prompt", "true")
+
+			var rateLimit *RateLimitError
+			switch {
+			case tt.rateLimit > 0:
+				if !errors.As(err, &rateLimit) || rateLimit.retryAfter != tt.rateLimit {
+					t.Errorf("error = %v, want a rate limit with retry after %s", err, tt.rateLimit)
+				}
+			case tt.err:
+				if err == nil || errors.As(err, &rateLimit) {
+					t.Errorf("error = %v, want a provider error", err)
+				}
+			case err != nil:
+				t.Errorf("unexpected error: %v", err)
+			}
+		})
+	}
+}
+
+func TestMockScript(t *testing.T) {
+	script := filepath.Join(t.TempDir(), "script.yaml")
+	err := os.WriteFile(script, []byte(`steps:
+  - match: "(?i)sql"
+    response: "false"
+  - response: "true"
+  - error: rate_limit
+    retryAfter: 1s
+  - error: overloaded
+`), 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	provider, err := newMock("script=" + script)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// rules answer whatever the call, the other steps cycle by the number of
+	// calls made, including those a rule answered
+	tests := []struct {
+		prompt string
+		want   string
+		err    string
+	}{
+		{prompt: "a", want: "true"},
+		{prompt: "SQL query", want: "false"},
+		{prompt: "b", err: "mock: overloaded"},
+		{prompt: "c", want: "true"},
+		{prompt: "d", err: "rate limit hit, retry after 1s"},
+	}
+
+	for _, tt := range tests {
+		resp, err := provider.Complete(context.Background(), CompletionRequest{Prompt: tt.prompt})
+		if tt.err != "" {
+			if err == nil || err.Error() != tt.err {
+				t.Errorf("%q: error = %v, want %s", tt.prompt, err, tt.err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("%q: %v", tt.prompt, err)
+		}
+		if resp.Content != tt.want {
+			t.Errorf("%q: Content = %q, want %q", tt.prompt, resp.Content, tt.want)
+		}
+	}
+}
+
+func TestMockInvalid(t *testing.T) {
+	dir := t.TempDir()
+	empty := filepath.Join(dir, "empty.yaml")
+	badMatch := filepath.Join(dir, "bad.yaml")
+	for path, content := range map[string]string{
+		empty:    "steps: []\n",
+		badMatch: "steps:\n  - match: \"(\"\n",
+	} {
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, llm := range []string{
+		"sometimes",
+		"random?accuracy=high",
+		"random?seed=x",
+		"always-true?latency=soon",
+		"script=" + filepath.Join(dir, "missing.yaml"),
+		"script=" + empty,
+		"script=" + badMatch,
+	} {
+		if _, err := newMock(llm); err == nil {
+			t.Errorf("newMock(%q): expected an error", llm)
+		}
+	}
+}
@@ -0,0 +1,119 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+type OpenAi struct {
+	client *openai.Client
+	llm    string
+}
+
+func newOpenAi(llm string) (Provider, error) {
+	var openAiObj OpenAi
+
+	OPENAI_API_KEY := os.Getenv("OPENAI_API_KEY")
+	if OPENAI_API_KEY == "" {
+		return nil, errors.New("to use Openai services you need to have the `OPENAI_API_KEY` environment variable set")
+	}
+
+	openAiObj.client = openai.NewClient(OPENAI_API_KEY)
+	openAiObj.llm = llm
+
+	return &openAiObj, nil
+}
+
+func (o *OpenAi) Name() string {
+	return "openai"
+}
+
+func (o *OpenAi) Model() string {
+	return o.llm
+}
+
+func (o *OpenAi) Complete(ctx context.Context, req CompletionRequest) (*CompletionResponse, error) {
+	start := time.Now()
+
+	resp, err := GetGPTResponse(ctx, o.client, req)
+	if err != nil {
+		return nil, err
+	}
+	if len(resp.Choices) == 0 {
+		return nil, errors.New("openai: response contained no choices")
+	}
+
+	return &CompletionResponse{
+		Content: resp.Choices[0].Message.Content,
+		Model:   resp.Model,
+		Usage: Usage{
+			PromptTokens:     resp.Usage.PromptTokens,
+			CompletionTokens: resp.Usage.CompletionTokens,
+			TotalTokens:      resp.Usage.TotalTokens,
+		},
+		Latency: time.Since(start),
+	}, nil
+}
+
+func GetGPTResponse(ctx context.Context, c *openai.Client, req CompletionRequest) (*openai.ChatCompletionResponse, error) {
+	var messages []openai.ChatCompletionMessage
+	if req.System != "" {
+		messages = append(messages, openai.ChatCompletionMessage{
+			Role:    openai.ChatMessageRoleSystem,
+			Content: req.System,
+		})
+	}
+	for _, message := range req.Messages {
+		messages = append(messages, openai.ChatCompletionMessage{
+			Role:    message.Role,
+			Content: message.Content,
+		})
+	}
+	messages = append(messages, openai.ChatCompletionMessage{
+		Role:    openai.ChatMessageRoleUser,
+		Content: req.Prompt,
+	})
+
+	chatReq := openai.ChatCompletionRequest{
+		Model:    req.Model,
+		Messages: messages,
+	}
+	if req.ResponseFormat == "json" {
+		chatReq.ResponseFormat = &openai.ChatCompletionResponseFormat{Type: openai.ChatCompletionResponseFormatTypeJSONObject}
+	}
+	if p := req.Params; p != nil {
+		if p.Temperature != nil {
+			chatReq.Temperature = openAiTemperature(*p.Temperature)
+		}
+		if p.TopP != nil {
+			chatReq.TopP = float32(*p.TopP)
+		}
+		if p.MaxTokens != nil {
+			chatReq.MaxTokens = *p.MaxTokens
+		}
+		chatReq.Seed = p.Seed
+		chatReq.Stop = p.Stop
+	}
+
+	resp, err := c.CreateChatCompletion(ctx, chatReq)
+
+	if err != nil {
+		var apiErr *openai.APIError
+		var reqErr *openai.RequestError
+		if (errors.As(err, &apiErr) && apiErr.HTTPStatusCode == http.StatusTooManyRequests) ||
+			(errors.As(err, &reqErr) && reqErr.HTTPStatusCode == http.StatusTooManyRequests) ||
+			strings.Contains(err.Error(), "Rate limit reached") {
+			retryAfter := ParseRateLimitError(err.Error())
+			return nil, &RateLimitError{retryAfter}
+		}
+		return nil, err
+	}
+
+	return &resp, nil
+}
@@ -33,7 +33,7 @@ func onRunPseudo(cmd *cobra.Command, args []string) {
 
 	if viper.GetBool("listTestOptions") {
 		testOptions := GetTestOptions()
-		fmt.Println("\nCompatible test frameworks: \n")
+		fmt.Print("\nCompatible test frameworks: \n\n")
 		for _, framework := range testOptions {
 			fmt.Println(framework)
 		}
@@ -43,7 +43,7 @@ func onRunPseudo(cmd *cobra.Command, args []string) {
 	// check config file for available LLMs
 	if viper.GetBool("listLlms") {
 		availableLlms := GetLLMs()
-		fmt.Println("\nAvailable LLMs loaded into config: \n")
+		fmt.Print("\nAvailable LLMs loaded into config: \n\n")
 		for _, llm := range availableLlms {
 			fmt.Println(llm)
 		}
@@ -52,16 +52,16 @@ func onRunPseudo(cmd *cobra.Command, args []string) {
 
 	if viper.GetBool("concurrent") {
 		// load csv file if a data-set is provided and get llm responses
-		results, seconds := SubmitPseudoDataAsync(10)
+		totals, seconds := SubmitPseudoDataAsync(10)
 
 		// visualize the results and output to HTML file
-		LoadResults(results, seconds)
+		LoadResults(totals, seconds)
 		return
 	}
 
 	// load csv file if a data-set is provided and get llm responses
-	results, seconds := SubmitPseudoData()
+	totals, seconds := SubmitPseudoData()
 
 	// visualize the results and output to HTML file
-	LoadResults(results, seconds)
+	LoadResults(totals, seconds)
 }
@@ -1,18 +1,17 @@
 package cmd
 
 import (
-	"encoding/csv"
 	"fmt"
-	"os"
+	"strconv"
 	"strings"
 	"time"
 
-	"github.com/schollz/progressbar/v3"
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
 )
 
 type PseudoDataEntry struct {
+	row         int
 	external    string
 	lesson      string
 	passed      bool
@@ -20,13 +19,121 @@ type PseudoDataEntry struct {
 	pseudoPatch string
 	vuln        string
 	reason      string
+	columns     map[string]string
+}
+
+func (e PseudoDataEntry) fields() map[string]string {
+	fields := map[string]string{}
+	for name, value := range e.columns {
+		fields[name] = value
+	}
+	fields["external"] = e.external
+	fields["lesson"] = e.lesson
+	fields["passed"] = strconv.FormatBool(e.passed)
+	fields["patch"] = e.patch
+	fields["pseudoPatch"] = e.pseudoPatch
+	fields["vuln"] = e.vuln
+	fields["reason"] = e.reason
+	return fields
+}
+
+func (e PseudoDataEntry) rowID() int {
+	return e.row
+}
+
+// parsePseudoDataEntry reads a "lesson,external,patch,passed,reason,vuln" row.
+// Any further columns are kept under their header names.
+func parsePseudoDataEntry(row int, header, record []string) (PseudoDataEntry, error) {
+	e := PseudoDataEntry{row: row}
+
+	if len(record) < 6 {
+		return e, fmt.Errorf("row %d has %d columns, expected at least 6", row, len(record))
+	}
+
+	e.passed = strings.ToLower(record[3]) == "true"
+	e.lesson = strings.ToLower(record[0])
+	e.external = record[1]
+	e.patch = record[2]
+	e.reason = record[4]
+	e.vuln = record[5]
+	e.columns = extraColumns(header, record, 6)
+
+	return e, checkLabelColumn(e)
+}
+
+// newPseudoDataEntry builds a pseudo data entry from the named fields of a
+// jsonl record or a csv with a schema.
+func newPseudoDataEntry(record datasetRecord) (PseudoDataEntry, error) {
+	e := PseudoDataEntry{row: record.row, columns: make(map[string]string)}
+	for name, value := range record.fields {
+		switch name {
+		case "lesson":
+			e.lesson = strings.ToLower(value)
+		case "external":
+			e.external = value
+		case "patch":
+			e.patch = value
+		case "passed":
+			e.passed = strings.ToLower(value) == "true"
+		case "reason":
+			e.reason = value
+		case "vuln":
+			e.vuln = value
+		default:
+			e.columns[name] = value
+		}
+	}
+	return e, checkLabelColumn(e)
+}
+
+// eachPseudoDataEntry streams the pseudo data entries of a csv or jsonl
+// dataset, which may be gzipped, to fn in order.
+func eachPseudoDataEntry(path string, fn func(PseudoDataEntry) error) error {
+	schema, err := loadSchema(path)
+	if err != nil {
+		return err
+	}
+
+	// without a schema, csv columns are read by position
+	if schema == nil && dataFormat(path) == "csv" {
+		var header []string
+		return scanCSV(path, func(row int, record []string) error {
+			if record[0] == strings.ToLower("lesson") {
+				header = record
+				return nil
+			}
+
+			e, err := parsePseudoDataEntry(row, header, record)
+			if err != nil {
+				return err
+			}
+			return fn(e)
+		})
+	}
+
+	return scanRecords(path, schema, func(record datasetRecord) error {
+		e, err := newPseudoDataEntry(record)
+		if err != nil {
+			return err
+		}
+		return fn(e)
+	})
+}
+
+func pseudoPrompt(e PseudoDataEntry) string {
+	return fmt.Sprintf("Vulnerable code: %s\nPatched Code: %s\nRequirements for passed test: %s", e.external, e.patch, e.vuln)
 }
 
 type PseudoResult struct {
-	data     *PseudoDataEntry
-	llm      string
-	response string
-	passed   bool
+	data         *PseudoDataEntry
+	llm          string
+	response     string
+	verdict      string
+	rationale    string
+	passed       bool
+	inconclusive bool
+	samples      []string
+	grade        *Grade
 }
 
 func (p *PseudoResult) GetData() interface{} {
@@ -53,6 +160,30 @@ func (p *PseudoResult) SetResponse(response string) {
 	p.response = response
 }
 
+func (p *PseudoResult) GetVerdict() string {
+	return p.verdict
+}
+
+func (p *PseudoResult) SetVerdict(verdict string) {
+	p.verdict = verdict
+}
+
+func (p *PseudoResult) GetRationale() string {
+	return p.rationale
+}
+
+func (p *PseudoResult) SetRationale(rationale string) {
+	p.rationale = rationale
+}
+
+func (p *PseudoResult) GetInconclusive() bool {
+	return p.inconclusive
+}
+
+func (p *PseudoResult) SetInconclusive(inconclusive bool) {
+	p.inconclusive = inconclusive
+}
+
 func (p *PseudoResult) GetLLM() string {
 	return p.llm
 }
@@ -61,48 +192,57 @@ func (p *PseudoResult) SetLLM(llm string) {
 	p.llm = llm
 }
 
-func SubmitPseudoData() ([]GlobalResult, time.Duration) {
+func (p *PseudoResult) GetSamples() []string {
+	return p.samples
+}
+
+func (p *PseudoResult) SetSamples(samples []string) {
+	p.samples = samples
+}
+
+func (p *PseudoResult) GetGrade() *Grade {
+	return p.grade
+}
+
+func (p *PseudoResult) SetGrade(grade *Grade) {
+	p.grade = grade
+}
+
+func SubmitPseudoData() (*runTotals, time.Duration) {
 	start := time.Now()
 
 	llmsObj := InitLLMs()
-	var results []GlobalResult
+	defer llmsObj.Close()
 
 	dataFile := viper.GetString("dataFile")
 	if dataFile == "" {
 		return nil, time.Since(start)
 	}
 
-	f, err := os.Open(dataFile)
-	cobra.CheckErr(err)
-	defer f.Close()
-
-	r, err := csv.NewReader(f).ReadAll()
-	cobra.CheckErr(err)
-	bar := progressbar.Default(int64(len(r))-1, "running tests")
-
-	for _, record := range r {
-		var e PseudoDataEntry
-
-		if record[0] == strings.ToLower("lesson") {
-			continue
+	selection, log, totals, bar := startRun(llmsObj, func(offer func(interface{})) error {
+		return eachPseudoDataEntry(dataFile, func(e PseudoDataEntry) error {
+			offer(e)
+			return nil
+		})
+	})
+	defer log.Close()
+
+	err := eachPseudoDataEntry(dataFile, func(e PseudoDataEntry) error {
+		if !selection.selected(e) {
+			return nil
 		}
 
-		e.passed = strings.ToLower(record[3]) == "true"
-		e.lesson = strings.ToLower(record[0])
-		e.external = record[1]
-		e.patch = record[2]
-		e.reason = record[4]
-		e.vuln = record[5]
-
-		prompt := fmt.Sprintf("Vulnerable code: %s\nPatched Code: %s\nRequirements for passed test: %s", e.external, e.patch, e.vuln)
-
-		constructedPrompt := createPrompt(prompt)
+		constructedPrompt := createPrompt(e, pseudoPrompt(e))
 
 		rowResults := createResults(llmsObj, e, constructedPrompt, bar)
-
-		results = append(results, rowResults...)
-	}
+		for _, res := range rowResults {
+			log.add(res)
+			totals.add(res)
+		}
+		return nil
+	})
+	cobra.CheckErr(err)
 
 	seconds := time.Since(start)
-	return results, seconds
+	return totals, seconds
 }
@@ -1,37 +1,32 @@
 package cmd
 
 import (
-	"encoding/csv"
-	"fmt"
-	"os"
-	"strings"
 	"sync"
 	"time"
 
-	"github.com/schollz/progressbar/v3"
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
 )
 
-func SubmitPseudoDataAsync(workerCount int) ([]GlobalResult, time.Duration) {
+func SubmitPseudoDataAsync(workerCount int) (*runTotals, time.Duration) {
 	start := time.Now()
 
 	llmsObj := InitLLMs()
-	var resultsList []GlobalResult
+	defer llmsObj.Close()
 
 	dataFile := viper.GetString("dataFile")
 	if dataFile == "" {
 		return nil, time.Since(start)
 	}
 
-	f, err := os.Open(dataFile)
-	cobra.CheckErr(err)
-	defer f.Close()
+	selection, log, totals, bar := startRun(llmsObj, func(offer func(interface{})) error {
+		return eachPseudoDataEntry(dataFile, func(e PseudoDataEntry) error {
+			offer(e)
+			return nil
+		})
+	})
+	defer log.Close()
 
-	r, err := csv.NewReader(f).ReadAll()
-	cobra.CheckErr(err)
-
-	bar := progressbar.Default(int64(len(r))-1, "running tests")
 	jobs := make(chan Job, workerCount)
 	results := make(chan *GlobalResult)
 	var wg sync.WaitGroup
@@ -44,39 +39,37 @@ func SubmitPseudoDataAsync(workerCount int) ([]GlobalResult, time.Duration) {
 		}()
 	}
 
+	// jobs holds at most workerCount jobs, so the dataset is read only as
+	// fast as the workers take them
 	go func() {
-		for _, record := range r {
-			var e PseudoDataEntry
-
-			if record[0] == strings.ToLower("lesson") {
-				continue
+		err := eachPseudoDataEntry(dataFile, func(e PseudoDataEntry) error {
+			if !selection.selected(e) {
+				return nil
 			}
 
-			e.passed = strings.ToLower(record[3]) == "true"
-			e.lesson = strings.ToLower(record[0])
-			e.external = record[1]
-			e.patch = record[2]
-			e.reason = record[4]
-			e.vuln = record[5]
-
-			prompt := fmt.Sprintf("Vulnerable code: %s\nPatched Code: %s\nRequirements for passed test: %s", e.external, e.patch, e.vuln)
-
-			constructedPrompt := createPrompt(prompt)
-
-			jobs <- Job{llmsObj, e, constructedPrompt}
-		}
+			constructedPrompt := createPrompt(e, pseudoPrompt(e))
+			for _, provider := range llmsObj.providers {
+				jobs <- Job{provider, e, constructedPrompt}
+			}
+			return nil
+		})
+		cobra.CheckErr(err)
 		close(jobs)
 	}()
 
+	done := make(chan struct{})
 	go func() {
 		for res := range results {
-			resultsList = append(resultsList, *res)
+			log.add(*res)
+			totals.add(*res)
 		}
+		close(done)
 	}()
 
 	wg.Wait()
 	close(results)
+	<-done
 
 	seconds := time.Since(start)
-	return resultsList, seconds
+	return totals, seconds
 }
@@ -11,37 +11,86 @@ import (
 func init() {
 	scoreCmd.AddCommand(runCmd)
 
+	runCmd.PersistentFlags().Int("bootstrap", 1000, "bootstrap resamples for the confidence intervals of each metric. (0 to disable)")
+	runCmd.PersistentFlags().Duration("cache-ttl", 0, "ignore cached responses older than this. (default is no expiry)")
 	runCmd.PersistentFlags().BoolP("concurrent", "C", false, "Run tests concurrently. (WARNING: may trigger rate limits quicker)")
-	runCmd.PersistentFlags().StringVarP(&dataFile, "dataFile", "d", "", "directory location for csv data set.")
+	runCmd.PersistentFlags().StringVarP(&dataFile, "dataFile", "d", "", "directory location for csv or jsonl data set, optionally gzipped.")
+	runCmd.PersistentFlags().String("dataFormat", "", "format of the data set: csv or jsonl. (default is by file extension)")
+	runCmd.PersistentFlags().StringVarP(&exportFile, "export", "e", "", "file location for a machine-readable (json) export of every result.")
+	runCmd.PersistentFlags().StringVar(&graderType, "grader", "", "grade responses with this grader instead of reading a verdict from them: verdict, exact, normalized, levenshtein, tokenF1, rougeL, bleu, regex, exec or judge. (see grader in the config)")
+	runCmd.PersistentFlags().StringVar(&judgeLLM, "judge", "", "llm used by the judge grader.")
+	runCmd.PersistentFlags().StringArray("filter", nil, "only run rows matching column==value or column!=value, e.g. lesson==sql-injection. (repeatable)")
+	runCmd.PersistentFlags().String("ids", "", "file location of the ids of the rows to run, one per line. (row numbers for data sets without an id column)")
+	runCmd.PersistentFlags().String("labelColumn", "", "grade against the labels in this dataset column instead of passed. (see verdict.labels)")
 	runCmd.PersistentFlags().BoolP("listLlms", "L", false, "show available LLMs for use.")
 	runCmd.PersistentFlags().BoolP("listTestOptions", "T", false, "show compatible test frameworks.")
 	runCmd.PersistentFlags().StringSliceP("llms", "l", llms, "llms to use (ensure the relevant API keys are set).")
+	runCmd.PersistentFlags().Bool("no-cache", false, "always call the LLM instead of using cached responses.")
 	runCmd.PersistentFlags().BoolP("noOutput", "N", false, "turn off HTML report generation.")
 	runCmd.PersistentFlags().StringVarP(&outputFile, "output", "o", "", "directory location for HTML report output. (default is $HOME/.score/reports)")
-	runCmd.PersistentFlags().StringVarP(&prompt, "prompt", "p", "", "prompt to test.")
-	runCmd.PersistentFlags().StringVarP(&promptFile, "promptFile", "f", "", "directory location of a txt file with a prompt.")
-	runCmd.PersistentFlags().StringVarP(&tests, "tests", "t", "", "directory location of a test file.")
+	runCmd.PersistentFlags().StringArray("param", nil, "override a generation parameter for every model, e.g. temperature=0. (repeatable)")
+	runCmd.PersistentFlags().StringVarP(&prompt, "prompt", "p", "", "prompt to test. Prompts containing {{ }} are Go templates over the dataset columns.")
+	runCmd.PersistentFlags().StringVarP(&promptFile, "promptFile", "f", "", "directory location of a txt file with a prompt, or a yaml/front-matter file with a system message and conversation turns.")
+	runCmd.PersistentFlags().StringVar(&recordFile, "record", "", "record every LLM request and response to a cassette (jsonl) file.")
+	runCmd.PersistentFlags().Int("sample", 0, "run a random sample of this many rows. (see --seed and --stratify-by)")
+	runCmd.PersistentFlags().Float64("sample-frac", 0, "run a random sample of this share of rows, e.g. 0.1.")
+	runCmd.PersistentFlags().Int("samples", 1, "query each model this many times per test and use the majority verdict.")
+	runCmd.PersistentFlags().String("results", "", "file location for the jsonl log every result is appended to as it completes. (default is a new file in $HOME/.score/results)")
+	runCmd.PersistentFlags().StringVar(&replayFile, "replay", "", "serve LLM responses from a cassette (jsonl) file instead of calling the API.")
+	runCmd.PersistentFlags().Bool("replayFallthrough", false, "call the live API for requests missing from the replay cassette.")
+	runCmd.PersistentFlags().Int64("seed", 0, "seed of the random sample, so the same rows are picked again.")
+	runCmd.PersistentFlags().StringSlice("stratify-by", nil, "sample each combination of these columns' values in proportion to the data set, e.g. lesson,vuln.")
+	runCmd.PersistentFlags().StringVarP(&systemPrompt, "systemPrompt", "s", "", "system prompt sent ahead of every test prompt.")
+	runCmd.PersistentFlags().StringVarP(&tests, "tests", "t", "", "test file, or directory of them, copied next to the code by the exec grader.")
 	runCmd.PersistentFlags().BoolP("verbose", "V", false, "show all debug messages.")
 
+	viper.BindPFlag("bootstrap", runCmd.PersistentFlags().Lookup("bootstrap"))
+	viper.BindPFlag("cacheTtl", runCmd.PersistentFlags().Lookup("cache-ttl"))
 	viper.BindPFlag("concurrent", runCmd.PersistentFlags().Lookup("concurrent"))
 	viper.BindPFlag("dataFile", runCmd.PersistentFlags().Lookup("dataFile"))
+	viper.BindPFlag("dataFormat", runCmd.PersistentFlags().Lookup("dataFormat"))
+	viper.BindPFlag("export", runCmd.PersistentFlags().Lookup("export"))
+	viper.BindPFlag("grader.type", runCmd.PersistentFlags().Lookup("grader"))
+	viper.BindPFlag("grader.judge.llm", runCmd.PersistentFlags().Lookup("judge"))
+	viper.BindPFlag("filters", runCmd.PersistentFlags().Lookup("filter"))
+	viper.BindPFlag("ids", runCmd.PersistentFlags().Lookup("ids"))
+	viper.BindPFlag("labelColumn", runCmd.PersistentFlags().Lookup("labelColumn"))
 	viper.BindPFlag("listTestOptions", runCmd.PersistentFlags().Lookup("listTestOptions"))
 	viper.BindPFlag("listLlms", runCmd.PersistentFlags().Lookup("listLlms"))
 	viper.BindPFlag("llms", runCmd.PersistentFlags().Lookup("llms"))
+	viper.BindPFlag("noCache", runCmd.PersistentFlags().Lookup("no-cache"))
 	viper.BindPFlag("noOutput", runCmd.PersistentFlags().Lookup("noOutput"))
 	viper.BindPFlag("output", runCmd.PersistentFlags().Lookup("output"))
+	viper.BindPFlag("params", runCmd.PersistentFlags().Lookup("param"))
 	viper.BindPFlag("prompt", runCmd.PersistentFlags().Lookup("prompt"))
 	viper.BindPFlag("promptFile", runCmd.PersistentFlags().Lookup("promptFile"))
+	viper.BindPFlag("record", runCmd.PersistentFlags().Lookup("record"))
+	viper.BindPFlag("replay", runCmd.PersistentFlags().Lookup("replay"))
+	viper.BindPFlag("replayFallthrough", runCmd.PersistentFlags().Lookup("replayFallthrough"))
+	viper.BindPFlag("results", runCmd.PersistentFlags().Lookup("results"))
+	viper.BindPFlag("sample", runCmd.PersistentFlags().Lookup("sample"))
+	viper.BindPFlag("sampleFrac", runCmd.PersistentFlags().Lookup("sample-frac"))
+	viper.BindPFlag("samples", runCmd.PersistentFlags().Lookup("samples"))
+	viper.BindPFlag("seed", runCmd.PersistentFlags().Lookup("seed"))
+	viper.BindPFlag("stratifyBy", runCmd.PersistentFlags().Lookup("stratify-by"))
+	viper.BindPFlag("systemPrompt", runCmd.PersistentFlags().Lookup("systemPrompt"))
+	viper.BindPFlag("tests", runCmd.PersistentFlags().Lookup("tests"))
 	viper.BindPFlag("verbose", runCmd.PersistentFlags().Lookup("verbose"))
 }
 
 var (
-	dataFile   string
-	llms       []string
-	outputFile string
-	prompt     string
-	promptFile string
-	tests      string
+	dataFile     string
+	exportFile   string
+	graderType   string
+	judgeLLM     string
+	llms         []string
+	outputFile   string
+	prompt       string
+	promptFile   string
+	recordFile   string
+	replayFile   string
+	systemPrompt string
+	tests        string
 
 	runCmd = &cobra.Command{
 		Use:   "run",
@@ -63,7 +112,7 @@ func onRun(cmd *cobra.Command, args []string) {
 
 	if viper.GetBool("listTestOptions") {
 		testOptions := GetTestOptions()
-		fmt.Println("\nCompatible test frameworks: \n")
+		fmt.Print("\nCompatible test frameworks: \n\n")
 		for _, framework := range testOptions {
 			fmt.Println(framework)
 		}
@@ -73,7 +122,7 @@ func onRun(cmd *cobra.Command, args []string) {
 	// check config file for available LLMs
 	if viper.GetBool("listLlms") {
 		availableLlms := GetLLMs()
-		fmt.Println("\nAvailable LLMs loaded into config: \n")
+		fmt.Print("\nAvailable LLMs loaded into config: \n\n")
 		for _, llm := range availableLlms {
 			fmt.Println(llm)
 		}
@@ -82,16 +131,16 @@ func onRun(cmd *cobra.Command, args []string) {
 
 	if viper.GetBool("concurrent") {
 		// load csv file if a data-set is provided and get llm responses
-		results, seconds := SubmitDataAsync(10)
+		totals, seconds := SubmitDataAsync(10)
 
 		// visualize the results and output to HTML file
-		LoadResults(results, seconds)
+		LoadResults(totals, seconds)
 		return
 	}
 
 	// load csv file if a data-set is provided and get llm responses
-	results, seconds := SubmitData()
+	totals, seconds := SubmitData()
 
 	// visualize the results and output to HTML file
-	LoadResults(results, seconds)
+	LoadResults(totals, seconds)
 }
@@ -2,17 +2,14 @@ package cmd
 
 import (
 	"context"
-	"encoding/csv"
 	"fmt"
 	"os"
 	"path/filepath"
+	"sort"
+	"strconv"
 	"strings"
 	"time"
 
-	"github.com/3JoB/anthropic-sdk-go/v2"
-	"github.com/3JoB/anthropic-sdk-go/v2/data"
-	"github.com/3JoB/anthropic-sdk-go/v2/resp"
-	"github.com/sashabaranov/go-openai"
 	"github.com/schollz/progressbar/v3"
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
@@ -20,31 +17,153 @@ import (
 	. "github.com/theplant/htmlgo"
 )
 
-type OpenAi struct {
-	client *openai.Client
-	llm    string
+type DataEntry struct {
+	row       int
+	passed    bool
+	diffDelta string
+	columns   map[string]string
 }
 
-type Anthropic struct {
-	client *anthropic.Client
-	llm    string
+func (e DataEntry) rowID() int {
+	return e.row
 }
 
-type DataEntry struct {
-	passed    bool
-	diffDelta string
+func (e DataEntry) fields() map[string]string {
+	fields := map[string]string{}
+	for name, value := range e.columns {
+		fields[name] = value
+	}
+	fields["passed"] = strconv.FormatBool(e.passed)
+	fields["diffDelta"] = e.diffDelta
+	return fields
+}
+
+// parseDataEntry reads a "passed,diffDelta" row. Columns after those two are
+// kept under their header names so prompt templates can reference them.
+func parseDataEntry(row int, header, record []string) (DataEntry, error) {
+	e := DataEntry{row: row}
+	var err error
+
+	if len(record) < 2 {
+		return e, fmt.Errorf("row %d has %d columns, expected at least 2", row, len(record))
+	}
+
+	e.passed = strings.ToLower(record[0]) == "true"
+	e.diffDelta, err = Base64Decode(record[1])
+	if err != nil {
+		return e, err
+	}
+
+	e.columns = extraColumns(header, record, 2)
+	return e, checkLabelColumn(e)
+}
+
+// newDataEntry builds a data entry from the named fields of a jsonl record or
+// a csv with a schema. Its diffDelta is taken as is, base64 only when the
+// schema says so, and every other field is kept by name.
+func newDataEntry(record datasetRecord) (DataEntry, error) {
+	e := DataEntry{row: record.row, columns: make(map[string]string)}
+	for name, value := range record.fields {
+		switch name {
+		case "passed":
+			e.passed = strings.ToLower(value) == "true"
+		case "diffDelta":
+			e.diffDelta = value
+		default:
+			e.columns[name] = value
+		}
+	}
+	return e, checkLabelColumn(e)
+}
+
+// eachDataEntry streams the data entries of a csv or jsonl dataset, which may
+// be gzipped, to fn in order, so datasets need not fit in memory.
+func eachDataEntry(path string, fn func(DataEntry) error) error {
+	schema, err := loadSchema(path)
+	if err != nil {
+		return err
+	}
+
+	// without a schema, csv columns are read by position
+	if schema == nil && dataFormat(path) == "csv" {
+		var header []string
+		return scanCSV(path, func(row int, record []string) error {
+			if record[0] == "passed" {
+				header = record
+				return nil
+			}
+
+			e, err := parseDataEntry(row, header, record)
+			if err != nil {
+				return err
+			}
+			return fn(e)
+		})
+	}
+
+	return scanRecords(path, schema, func(record datasetRecord) error {
+		e, err := newDataEntry(record)
+		if err != nil {
+			return err
+		}
+		return fn(e)
+	})
+}
+
+// checkLabelColumn makes sure a data entry has the --labelColumn column.
+func checkLabelColumn(e interface{}) error {
+	column := viper.GetString("labelColumn")
+	if column == "" {
+		return nil
+	}
+	if _, ok := entryFields(e)[column]; !ok {
+		return fmt.Errorf("label column %q is not in the dataset", column)
+	}
+	return nil
+}
+
+func extraColumns(header, record []string, from int) map[string]string {
+	columns := make(map[string]string)
+	for i := from; i < len(record) && i < len(header); i++ {
+		columns[header[i]] = record[i]
+	}
+	return columns
+}
+
+// entryRow returns the row number of a data entry in its dataset, used to
+// pair up the results of different models or runs.
+func entryRow(e interface{}) int {
+	if entry, ok := e.(interface{ rowID() int }); ok {
+		return entry.rowID()
+	}
+	return 0
+}
+
+// entryFields returns the named columns of a data entry.
+func entryFields(e interface{}) map[string]string {
+	if entry, ok := e.(interface{ fields() map[string]string }); ok {
+		return entry.fields()
+	}
+	return nil
 }
 
 type Result struct {
-	data     *DataEntry
-	llm      string
-	response string
-	passed   bool
+	data         *DataEntry
+	llm          string
+	response     string
+	verdict      string
+	rationale    string
+	passed       bool
+	inconclusive bool
+	samples      []string
+	grade        *Grade
 }
 
 type LLMs struct {
-	anthropic *Anthropic
-	openAi    *OpenAi
+	providers []Provider
+	recorder  *cassetteRecorder
+	cache     *responseCache
+	replay    *cassette
 }
 
 type FinalResult struct {
@@ -55,7 +174,13 @@ type FinalResult struct {
 	inconclusive              int
 	percentage                float64
 	percentageNoInconclusives float64
+	meanScore                 *float64
+	selection                 *rowSelection
+	generatedAt               time.Time
+	models                    []modelSummary
+	comparisons               []modelComparison
 	results                   []GlobalResult
+	omitted                   int
 }
 
 type GlobalResult interface {
@@ -65,8 +190,18 @@ type GlobalResult interface {
 	SetPassed(passed bool)
 	GetResponse() string
 	SetResponse(response string)
+	GetVerdict() string
+	SetVerdict(verdict string)
+	GetRationale() string
+	SetRationale(rationale string)
+	GetInconclusive() bool
+	SetInconclusive(inconclusive bool)
 	GetLLM() string
 	SetLLM(llm string)
+	GetSamples() []string
+	SetSamples(samples []string)
+	GetGrade() *Grade
+	SetGrade(grade *Grade)
 }
 
 func (r *Result) GetData() interface{} {
@@ -93,112 +228,120 @@ func (r *Result) SetResponse(response string) {
 	r.response = response
 }
 
-func (r *Result) GetLLM() string {
-	return r.llm
+func (r *Result) GetVerdict() string {
+	return r.verdict
 }
 
-func (r *Result) SetLLM(llm string) {
-	r.llm = llm
+func (r *Result) SetVerdict(verdict string) {
+	r.verdict = verdict
 }
 
-func (fr FinalResult) String() string {
-	return fmt.Sprintf("Results achieved in %v\n\nThere were a total of %d tests ran.\n\tPassed: %d\n\tFailed: %d\n\tInconclusive: "+
-		"%d\n\nScore: %.2f%%\nScore excluding inconclusive tests: %.2f%%\n",
-		fr.seconds, fr.total, fr.passed, fr.failed, fr.inconclusive, fr.percentage, fr.percentageNoInconclusives)
+func (r *Result) GetRationale() string {
+	return r.rationale
 }
 
-type RateLimitError struct {
-	retryAfter time.Duration
+func (r *Result) SetRationale(rationale string) {
+	r.rationale = rationale
 }
 
-func (e *RateLimitError) Error() string {
-	return fmt.Sprintf("rate limit hit, retry after %s", e.retryAfter)
+func (r *Result) GetInconclusive() bool {
+	return r.inconclusive
 }
 
-const UsageMsg = "Usage: score run [-p, --prompt] <prompt> [-l, --llms] <llms> || score run [-f, --prompt-file] <prompt.txt> [-l, --llms] <llms>\n"
-
-func initOpenAi(llm string) *OpenAi {
-	var openAiObj OpenAi
-
-	OPENAI_API_KEY := os.Getenv("OPENAI_API_KEY")
-	if OPENAI_API_KEY == "" {
-		cobra.CompError("To use Openai services you need to have the `OPENAI_API_KEY` environment variable set.\n")
-		os.Exit(1)
-	}
-
-	openAiObj.client = openai.NewClient(OPENAI_API_KEY)
-	openAiObj.llm = llm
-
-	return &openAiObj
+func (r *Result) SetInconclusive(inconclusive bool) {
+	r.inconclusive = inconclusive
 }
 
-func initAnthropic(llm string) *Anthropic {
-	var anthropicObj Anthropic
+func (r *Result) GetLLM() string {
+	return r.llm
+}
 
-	ANTHROPIC_API_KEY := os.Getenv("ANTHROPIC_API_KEY")
-	if ANTHROPIC_API_KEY == "" {
-		cobra.CompError("To use Anthropic (Claude) services you need to have the `ANTHROPIC_API_KEY` environment variable set.\n")
-		os.Exit(1)
-	}
+func (r *Result) SetLLM(llm string) {
+	r.llm = llm
+}
 
-	client, err := anthropic.New(&anthropic.Config{Key: ANTHROPIC_API_KEY, DefaultModel: data.ModelFullInstant})
-	cobra.CheckErr(err)
+func (r *Result) GetSamples() []string {
+	return r.samples
+}
 
-	anthropicObj.client = client
-	anthropicObj.llm = llm
+func (r *Result) SetSamples(samples []string) {
+	r.samples = samples
+}
 
-	return &anthropicObj
+func (r *Result) GetGrade() *Grade {
+	return r.grade
 }
 
-func GetGPTResponse(c *openai.Client, prompt, model string) (string, error) {
-	resp, err := c.CreateChatCompletion(
-		context.Background(),
-		openai.ChatCompletionRequest{
-			Model: model,
-			Messages: []openai.ChatCompletionMessage{
-				{
-					Role:    openai.ChatMessageRoleUser,
-					Content: prompt,
-				},
-			},
-		},
-	)
+func (r *Result) SetGrade(grade *Grade) {
+	r.grade = grade
+}
 
-	if err != nil {
-		if strings.Contains(err.Error(), "Rate limit reached") {
-			retryAfter := ParseRateLimitError(err.Error())
-			return "", &RateLimitError{retryAfter}
+func (fr FinalResult) String() string {
+	var models strings.Builder
+	for _, model := range fr.models {
+		models.WriteString("\t" + model.String() + "\n")
+		if model.Confusion != nil {
+			models.WriteString("\t\t" + model.Confusion.String() + "\n")
+		}
+		for _, class := range model.Classes {
+			models.WriteString("\t\t" + class.String() + "\n")
+		}
+		if model.Matrix != nil {
+			models.WriteString("\t\tmacro average: " + model.Metrics.String() + "\n")
+		} else {
+			models.WriteString("\t\t" + model.Metrics.String() + "\n")
+		}
+		if model.Intervals != nil {
+			models.WriteString("\t\t" + model.Intervals.String() + "\n")
+		}
+	}
+	if len(fr.comparisons) > 0 {
+		models.WriteString("\nModel comparisons (McNemar's exact test):\n")
+		for _, comparison := range fr.comparisons {
+			models.WriteString("\t" + comparison.String() + "\n")
 		}
-		return "", err
 	}
 
-	return resp.Choices[0].Message.Content, nil
-}
-
-func GetClaudeResponse(c *anthropic.Client, prompt, model string) (string, error) {
-	d, err := c.Send(&anthropic.Sender{
-		Message: data.MessageModule{
-			Human: prompt,
-		},
-		Sender: &resp.Sender{MaxToken: 1200},
-	})
+	var graded string
+	if fr.meanScore != nil {
+		graded = fmt.Sprintf("Mean grader score: %.3f\n", *fr.meanScore)
+	}
 
-	if err != nil {
-		if strings.Contains(err.Error(), "rate limit") {
-			return "", &RateLimitError{}
-		}
-		return "", err
+	var selected string
+	if fr.selection != nil {
+		selected = fmt.Sprintf("Rows: %s\n", fr.selection)
 	}
 
-	return d.Response.Completion[1:], nil
+	return fmt.Sprintf("Results achieved in %v\n\n%sThere were a total of %d tests ran.\n\tPassed: %d\n\tFailed: %d\n\tInconclusive: "+
+		"%d\n\nScore: %.2f%%\nScore excluding inconclusive tests: %.2f%%\n%s\nScore per model:\n%s",
+		fr.seconds, selected, fr.total, fr.passed, fr.failed, fr.inconclusive, fr.percentage, fr.percentageNoInconclusives, graded, models.String())
+}
+
+type RateLimitError struct {
+	retryAfter time.Duration
 }
 
+func (e *RateLimitError) Error() string {
+	return fmt.Sprintf("rate limit hit, retry after %s", e.retryAfter)
+}
+
+const UsageMsg = "Usage: score run [-p, --prompt] <prompt> [-l, --llms] <llms> || score run [-f, --prompt-file] <prompt.txt> [-l, --llms] <llms>\n"
+
 func GetLLMs() []string {
 	return viper.GetStringSlice("supportedLLMs")
 }
 
+// GetTestOptions lists the frameworks the exec grader can run, with the file
+// the code under test is written to and the test command.
 func GetTestOptions() []string {
-	return viper.GetStringSlice("supportedTestFrameworks")
+	var options []string
+	for _, name := range viper.GetStringSlice("supportedTestFrameworks") {
+		if framework, ok := testFrameworks[name]; ok {
+			name = fmt.Sprintf("%s: %s (%s)", name, strings.Join(framework.command, " "), framework.file)
+		}
+		options = append(options, name)
+	}
+	return options
 }
 
 func SetOutputConfig() {
@@ -214,58 +357,107 @@ func CheckRunEmpty(args []string) bool {
 		viper.GetString("tests") == ""
 }
 
-func createPrompt(appendedData string) string {
-	var prompt string
-	argPrompt := viper.GetString("prompt")
-	argPromptFile := viper.GetString("promptFile")
-	if argPrompt == "" && argPromptFile == "" {
+func InitLLMs() *LLMs {
+	var llmsObj LLMs
+
+	llms := viper.GetStringSlice("llms")
+	if len(llms) == 0 {
 		cobra.CompError(UsageMsg)
 		os.Exit(1)
 	}
 
-	if argPromptFile != "" {
-		dat, err := os.ReadFile(argPromptFile)
+	cobra.CheckErr(registerEndpoints())
+	initVerdictExtractor()
+
+	var err error
+	if recordFile := viper.GetString("record"); recordFile != "" {
+		llmsObj.recorder, err = newCassetteRecorder(recordFile)
 		cobra.CheckErr(err)
-		prompt = string(dat)
-	} else {
-		prompt = argPrompt
 	}
 
-	return prompt + appendedData
-}
-
-func InitLLMs() *LLMs {
-	var llmsObj LLMs
-
-	// add additional llm support here
-	var openAiObj *OpenAi
-	var anthropicObj *Anthropic
+	if !viper.GetBool("noCache") {
+		llmsObj.cache = newResponseCache(viper.GetDuration("cacheTtl"))
+	}
 
-	llms := viper.GetStringSlice("llms")
-	if len(llms) == 0 {
-		cobra.CompError(UsageMsg)
-		os.Exit(1)
+	if replayFile := viper.GetString("replay"); replayFile != "" {
+		llmsObj.replay, err = loadCassette(replayFile)
+		cobra.CheckErr(err)
 	}
 
+	seen := make(map[string]bool)
 	for _, llm := range llms {
 		llm = strings.TrimSpace(llm)
-
-		if llm[:3] == "gpt" {
-			openAiObj = initOpenAi(llm)
-		} else if llm[:6] == "claude" {
-			anthropicObj = initAnthropic(llm)
+		if llm == "" || seen[llm] {
+			continue
 		}
+		seen[llm] = true
+
+		provider, err := llmsObj.newProvider(llm)
+		cobra.CheckErr(err)
+
+		llmsObj.providers = append(llmsObj.providers, provider)
 	}
 
-	llmsObj.anthropic = anthropicObj
-	llmsObj.openAi = openAiObj
+	err = initGrader(&llmsObj)
+	cobra.CheckErr(err)
 
 	return &llmsObj
 }
 
-func createResults(llmsObj *LLMs, e interface{}, constructedPrompt string, bar *progressbar.ProgressBar) []GlobalResult {
-	// add additional llm support here
-	var results []GlobalResult
+// newProvider builds the provider for an llm, wrapped in the response cache,
+// cassette recorder and replayer as configured.
+func (l *LLMs) newProvider(llm string) (Provider, error) {
+	factory, model, err := resolveProvider(llm)
+	if err != nil {
+		return nil, err
+	}
+
+	// a pure replay never reaches the API, so no credentials are needed
+	var provider Provider
+	if l.replay == nil || viper.GetBool("replayFallthrough") {
+		provider, err = factory(model)
+		if err != nil {
+			return nil, err
+		}
+
+		// mock responses are free and may simulate failures, so never cache them
+		if l.cache != nil && provider.Name() != "mock" {
+			provider = &cachingProvider{provider, l.cache}
+		}
+
+		if l.recorder != nil {
+			provider = &recordingProvider{provider, llm, l.recorder}
+		}
+	}
+
+	if l.replay != nil {
+		replayed := &replayingProvider{live: provider, llm: llm, cassette: l.replay}
+		if provider != nil {
+			replayed.name, replayed.model, replayed.settings = provider.Name(), provider.Model(), providerSettings(provider)
+		} else if entry, ok := l.replay.llms[llm]; ok {
+			replayed.name, replayed.model, replayed.settings = entry.Provider, entry.Model, entry.Settings
+		} else {
+			return nil, fmt.Errorf("replay: %s has no recordings for %s", viper.GetString("replay"), llm)
+		}
+		provider = replayed
+	}
+
+	if err := initModelParams(llm, provider.Model()); err != nil {
+		return nil, err
+	}
+	providerLLMs[provider] = llm
+
+	return provider, nil
+}
+
+func (l *LLMs) Close() {
+	if l.recorder != nil {
+		cobra.CheckErr(l.recorder.Close())
+	}
+}
+
+// newResult wraps a data entry in the result type matching its mode.
+func newResult(e interface{}) GlobalResult {
 	var res GlobalResult
 
 	switch v := e.(type) {
@@ -275,45 +467,43 @@ func createResults(llmsObj *LLMs, e interface{}, constructedPrompt string, bar *
 	case PseudoDataEntry:
 		res = &PseudoResult{}
 		res.SetData(&v)
-	default:
-		return nil
 	}
 
-	if llmsObj.openAi != nil {
-		res.SetLLM(llmsObj.openAi.llm)
-
-		response, err := processWithRetries(func() (string, error) {
-			return GetGPTResponse(llmsObj.openAi.client, constructedPrompt, llmsObj.openAi.llm)
-		})
-		cobra.CheckErr(err)
+	return res
+}
 
-		if strings.ToLower(response) == "true" {
-			res.SetPassed(true)
-		} else if strings.ToLower(response) == "false" {
-			res.SetPassed(false)
-		} else {
-			res.SetResponse(response)
-		}
+// applyResponse sets a response and its label on the result. Graded
+// responses keep the grader's rationale in their grade instead.
+func applyResponse(res GlobalResult, response *CompletionResponse, label string, grade *Grade) {
+	res.SetResponse(response.Content)
+	res.SetGrade(grade)
+	if grade == nil {
+		res.SetRationale(verdictExtractor.Rationale(response.Content))
+	}
 
-		results = append(results, res)
-		bar.Add(1)
+	if label != inconclusiveLabel {
+		res.SetPassed(label == "true")
+		res.SetVerdict(label)
+	} else {
+		res.SetInconclusive(true)
 	}
+}
+
+func createResults(llmsObj *LLMs, e interface{}, constructedPrompt string, bar *progressbar.ProgressBar) []GlobalResult {
+	var results []GlobalResult
 
-	if llmsObj.anthropic != nil {
-		res.SetLLM(llmsObj.anthropic.llm)
+	for _, provider := range llmsObj.providers {
+		res := newResult(e)
+		if res == nil {
+			return nil
+		}
+		res.SetLLM(provider.Model())
 
-		response, err := processWithRetries(func() (string, error) {
-			return GetClaudeResponse(llmsObj.anthropic.client, constructedPrompt, llmsObj.anthropic.llm)
-		})
+		responses, err := completeSamples(provider, e, constructedPrompt)
 		cobra.CheckErr(err)
 
-		if strings.ToLower(response) == "true" {
-			res.SetPassed(true)
-		} else if strings.ToLower(response) == "false" {
-			res.SetPassed(false)
-		} else {
-			res.SetResponse(response)
-		}
+		err = applySamples(res, responses)
+		cobra.CheckErr(err)
 
 		results = append(results, res)
 		bar.Add(1)
@@ -327,7 +517,7 @@ func ParseRateLimitError(message string) time.Duration {
 	return 5 * time.Second
 }
 
-func processWithRetries(request func() (string, error)) (string, error) {
+func processWithRetries(request func() (*CompletionResponse, error)) (*CompletionResponse, error) {
 	for {
 		response, err := request()
 		if err != nil {
@@ -338,96 +528,95 @@ func processWithRetries(request func() (string, error)) (string, error) {
 				time.Sleep(rateLimitError.retryAfter)
 				continue
 			} else {
-				return "", err
+				return nil, err
 			}
 		}
 		return response, nil
 	}
 }
 
-func SubmitData() ([]GlobalResult, time.Duration) {
+// startRun reads the dataset once up front to pick the rows to run, and to
+// stop on a bad one before any model is called, then opens the result log,
+// totals and progress bar of the run. scan offers every data entry.
+func startRun(llmsObj *LLMs, scan func(offer func(e interface{})) error) (*rowSelection, *resultLog, *runTotals, *progressbar.ProgressBar) {
+	selection, err := newRowSelection()
+	cobra.CheckErr(err)
+	err = scan(selection.offer)
+	cobra.CheckErr(err)
+	rows, err := selection.choose()
+	cobra.CheckErr(err)
+
+	log := openResultLog()
+	totals := newRunTotals(len(llmsObj.providers))
+	bar := progressbar.Default(int64(rows)*int64(len(llmsObj.providers)), "running tests")
+
+	return selection, log, totals, bar
+}
+
+func SubmitData() (*runTotals, time.Duration) {
 	start := time.Now()
 
 	llmsObj := InitLLMs()
-	var results []GlobalResult
+	defer llmsObj.Close()
 
 	dataFile := viper.GetString("dataFile")
 	if dataFile == "" {
 		return nil, time.Since(start)
 	}
 
-	f, err := os.Open(dataFile)
-	cobra.CheckErr(err)
-	defer f.Close()
-
-	r, err := csv.NewReader(f).ReadAll()
-	cobra.CheckErr(err)
-	bar := progressbar.Default(int64(len(r))-1, "running tests")
-
-	for _, record := range r {
-		var e DataEntry
+	selection, log, totals, bar := startRun(llmsObj, func(offer func(interface{})) error {
+		return eachDataEntry(dataFile, func(e DataEntry) error {
+			offer(e)
+			return nil
+		})
+	})
+	defer log.Close()
 
-		if record[0] == "passed" {
-			continue
+	err := eachDataEntry(dataFile, func(e DataEntry) error {
+		if !selection.selected(e) {
+			return nil
 		}
 
-		e.passed = strings.ToLower(record[0]) == "true"
-		e.diffDelta, err = Base64Decode(record[1])
-		cobra.CheckErr(err)
-
-		constructedPrompt := createPrompt(e.diffDelta)
+		constructedPrompt := createPrompt(e, e.diffDelta)
 
 		if rowResults := createResults(llmsObj, e, constructedPrompt, bar); rowResults == nil {
 			cobra.CompError("Invalid type passed to createResults().\n")
 		} else {
-			results = append(results, rowResults...)
+			for _, res := range rowResults {
+				log.add(res)
+				totals.add(res)
+			}
 		}
-	}
+		return nil
+	})
+	cobra.CheckErr(err)
 
 	seconds := time.Since(start)
-	return results, seconds
+	return totals, seconds
 }
 
-func LoadResults(results []GlobalResult, seconds time.Duration) {
+func LoadResults(totals *runTotals, seconds time.Duration) {
 	var finalResult FinalResult
-	total := len(results)
-	var passed, failed, inconclusive int = 0, 0, 0
-
-	for k, v := range results {
-		if v.GetResponse() == "" {
-			switch d := v.GetData().(type) {
-			case *DataEntry:
-				if viper.GetBool("verbose") {
-					fmt.Println(k, d.passed, v)
-				}
-
-				if v.GetPassed() == d.passed {
-					passed++
-				} else {
-					failed++
-				}
-			case *PseudoDataEntry:
-				if viper.GetBool("verbose") {
-					fmt.Println(k, d.passed, v)
-				}
+	if totals == nil {
+		totals = newRunTotals(0)
+	}
 
-				if v.GetPassed() == d.passed {
-					passed++
-				} else {
-					failed++
-				}
-			}
-		} else {
-			inconclusive++
-		}
+	models := totals.summaries()
+	var total, passed, failed, inconclusive int
+	for _, model := range models {
+		total += model.Total
+		passed += model.Passed
+		failed += model.Failed
+		inconclusive += model.Inconclusive
 	}
 
 	if viper.GetBool("verbose") {
 		fmt.Println()
 	}
 
-	percentage := Round((float64(passed)/float64(total))*100, 0.05)
-	percentageNoInconclusives := Round((float64(passed)/float64(total-inconclusive))*100, 0.05)
+	// with every result inconclusive there is no score to export as JSON
+	percentage := Round(ratio(float64(passed), float64(total))*100, 0.05)
+	percentageNoInconclusives := Round(ratio(float64(passed), float64(total-inconclusive))*100, 0.05)
 
 	finalResult.failed = failed
 	finalResult.total = total
@@ -435,8 +624,14 @@ func LoadResults(results []GlobalResult, seconds time.Duration) {
 	finalResult.inconclusive = inconclusive
 	finalResult.percentage = percentage
 	finalResult.percentageNoInconclusives = percentageNoInconclusives
+	finalResult.meanScore = totals.meanScore()
+	finalResult.selection = runSelection
 	finalResult.seconds = seconds
-	finalResult.results = results
+	finalResult.generatedAt = time.Now()
+	finalResult.models = models
+	finalResult.comparisons = totals.comparisons()
+	finalResult.results = totals.detailed
+	finalResult.omitted = totals.omitted
 
 	fmt.Println(finalResult)
 
@@ -444,22 +639,247 @@ func LoadResults(results []GlobalResult, seconds time.Duration) {
 		GenerateBarChart(&finalResult)
 		GenerateHTML(&finalResult)
 	}
+
+	if exportFile := viper.GetString("export"); exportFile != "" {
+		WriteExport(&finalResult, exportFile)
+	}
 }
 
-func GenerateHTML(f *FinalResult) {
+func verdictText(result GlobalResult) string {
+	if result.GetInconclusive() {
+		return inconclusiveLabel
+	}
+	return result.GetVerdict()
+}
+
+// resultCorrect reports whether a result's verdict matches its expected label.
+func resultCorrect(result GlobalResult) bool {
+	return newOutcome(result).correct()
+}
+
+// modelsParagraph lists the score, and with --samples the stability, of each
+// model, followed by its confusion matrix and metrics.
+func modelsParagraph(f *FinalResult) HTMLComponent {
+	paragraph := P()
+	for _, model := range f.models {
+		paragraph.AppendChildren(Text(model.String()), Br())
+	}
+
+	head := Tr(Th("LLM"))
+	if multiClass() {
+		head.AppendChildren(Th("Inconclusive"), Th("Macro Precision"), Th("Macro Recall"), Th("Macro F1"),
+			Th("Macro Specificity"), Th("Balanced Accuracy"), Th("MCC"))
+	} else {
+		head.AppendChildren(Th("TP"), Th("FP"), Th("TN"), Th("FN"), Th("Inconclusive (true/false)"),
+			Th("Precision"), Th("Recall"), Th("F1"), Th("Specificity"), Th("Balanced Accuracy"), Th("MCC"))
+	}
+
+	body := Tbody()
+	var matrices []HTMLComponent
+	for _, model := range f.models {
+		m := model.Metrics
+		ci := model.Intervals
+		if ci == nil {
+			ci = &metricIntervals{}
+		}
+
+		row := Tr(Td(Text(model.LLM)))
+		if c := model.Confusion; c != nil {
+			row.AppendChildren(
+				Td(Textf("%d", c.TP)), Td(Textf("%d", c.FP)), Td(Textf("%d", c.TN)), Td(Textf("%d", c.FN)),
+				Td(Textf("%d/%d", c.InconclusiveTrue, c.InconclusiveFalse)),
+			)
+		} else {
+			row.AppendChildren(Td(Textf("%d", model.Inconclusive)))
+		}
+		row.AppendChildren(
+			metricCell(m.Precision, ci.Precision, model.Intervals != nil),
+			metricCell(m.Recall, ci.Recall, model.Intervals != nil),
+			metricCell(m.F1, ci.F1, model.Intervals != nil),
+			metricCell(m.Specificity, ci.Specificity, model.Intervals != nil),
+			metricCell(m.BalancedAccuracy, ci.BalancedAccuracy, model.Intervals != nil),
+			metricCell(m.MCC, ci.MCC, model.Intervals != nil),
+		)
+		body.AppendChildren(row)
+
+		if model.Matrix != nil {
+			matrices = append(matrices, H3(model.LLM), labelMatrixTable(model.Matrix), classesTable(model.Classes))
+		}
+	}
+
+	return Components(paragraph, Table(Thead(head), body).Class("metrics"), Components(matrices...), comparisonsTable(f))
+}
+
+// labelMatrixTable shows expected labels as rows and verdicts as columns.
+func labelMatrixTable(lm *labelMatrix) HTMLComponent {
+	head := Tr(Th("Expected \\ Verdict"))
+	for _, label := range lm.Labels {
+		head.AppendChildren(Th(label))
+	}
+	head.AppendChildren(Th(inconclusiveLabel))
+
+	body := Tbody()
+	for _, expected := range lm.Labels {
+		row := Tr(Th(expected))
+		for _, verdict := range append(append([]string{}, lm.Labels...), inconclusiveLabel) {
+			row.AppendChildren(Td(Textf("%d", lm.Counts[expected][verdict])))
+		}
+		body.AppendChildren(row)
+	}
+
+	return Table(Thead(head), body).Class("metrics")
+}
+
+func classesTable(classes []classMetrics) HTMLComponent {
+	body := Tbody()
+	for _, c := range classes {
+		body.AppendChildren(Tr(
+			Td(Text(c.Label)), Td(Textf("%.3f", c.Precision)), Td(Textf("%.3f", c.Recall)),
+			Td(Textf("%.3f", c.F1)), Td(Textf("%d", c.Support)),
+		))
+	}
+
+	return Table(Thead(Tr(Th("Label"), Th("Precision"), Th("Recall"), Th("F1"), Th("Support"))), body).Class("metrics")
+}
+
+func metricCell(value float64, ci interval, withInterval bool) HTMLComponent {
+	return Td(
+		Textf("%.3f", value),
+		Iff(withInterval, func() HTMLComponent {
+			return Components(Br(), Small(ci.String()))
+		}),
+	)
+}
+
+// comparisonsTable shows the McNemar's test between each pair of models.
+func comparisonsTable(f *FinalResult) HTMLComponent {
+	if len(f.comparisons) == 0 {
+		return nil
+	}
+
+	body := Tbody()
+	for _, c := range f.comparisons {
+		body.AppendChildren(Tr(
+			Td(Text(c.A)), Td(Text(c.B)), Td(Textf("%d", c.Rows)),
+			Td(Textf("%+.2f", c.Difference)), Td(Textf("%d/%d", c.AOnly, c.BOnly)),
+			Td(Textf("%.4f", c.PValue)), Td(Text(strconv.FormatBool(c.significant()))),
+		))
+	}
+
+	return Components(
+		H3("Model comparisons (McNemar's exact test)"),
+		Table(Thead(Tr(
+			Th("A"), Th("B"), Th("Rows"), Th("Difference (points)"), Th("Discordant (A/B only correct)"),
+			Th("p-value"), Th(fmt.Sprintf("Significant (p < %.2f)", significanceLevel)),
+		)), body).Class("metrics"),
+	)
+}
+
+// gradeText shows the score and rationale a grader gave a result.
+func gradeText(grade *Grade) HTMLComponent {
+	score := Textf("Score: %.2f (%s)", grade.Score, grade.Grader)
+	if grade.Inconclusive {
+		score = Textf("Score: inconclusive (%s)", grade.Grader)
+	}
+	label := "Grader Rationale"
+	if strings.HasPrefix(grade.Grader, "judge:") {
+		label = "Judge Rationale"
+	}
+	return Components(
+		score,
+		Br(),
+		Iff(len(grade.Rationale) > 0, func() HTMLComponent {
+			return Components(Textf("%s: %s", label, grade.Rationale), Br())
+		}),
+	)
+}
+
+func samplesText(result GlobalResult) HTMLComponent {
+	return Textf("Samples: %s (%.0f%% agreement)", strings.Join(result.GetSamples(), ", "), sampleAgreement(result.GetSamples())*100)
+}
+
+// flakyDiv lists the tests whose verdict changed between samples.
+func flakyDiv(f *FinalResult) HTMLComponent {
+	div := Div(H2("Flaky Tests"))
+
+	flaky := 0
+	for _, result := range f.results {
+		if !isFlaky(result.GetSamples()) {
+			continue
+		}
+		flaky++
+
+		div.AppendChildren(P(
+			Textf("LLM: %s said %s", result.GetLLM(), verdictText(result)),
+			Br(),
+			Textf("Expected Result: %s", expectedLabel(result.GetData())),
+			Br(),
+			samplesText(result),
+		), Hr())
+	}
+
+	if flaky == 0 {
+		return nil
+	}
+	return div
+}
+
+// selectionParagraph shows which rows of the dataset ran, and with
+// --stratify-by how many of each stratum.
+func selectionParagraph(f *FinalResult) HTMLComponent {
+	if f.selection == nil {
+		return nil
+	}
+
+	strata := make([]string, 0, len(f.selection.Strata))
+	for stratum := range f.selection.Strata {
+		strata = append(strata, stratum)
+	}
+	sort.Strings(strata)
+
+	paragraph := P(Textf("Rows: %s", f.selection), Br())
+	for _, stratum := range strata {
+		paragraph.AppendChildren(Textf("%s: %d", stratum, f.selection.Strata[stratum]), Br())
+	}
+	return paragraph
+}
+
+// paramsParagraph lists the generation parameters each llm ran with.
+func paramsParagraph() HTMLComponent {
+	llms := make([]string, 0, len(modelParams))
+	for llm := range modelParams {
+		llms = append(llms, llm)
+	}
+	sort.Strings(llms)
+
+	paragraph := P()
+	for _, llm := range llms {
+		paragraph.AppendChildren(Textf("%s: %s", llm, modelParams[llm]), Br())
+	}
+	return paragraph
+}
+
+// reportPath is the configured outputFile with a timestamp, and an optional
+// tag, inserted before its extension. Its directory is created if needed.
+func reportPath(f *FinalResult, tag string) string {
 	outputFilePath := os.ExpandEnv(viper.GetString("outputFile"))
 
-	now := time.Now()
-	timeSuffix := now.Format("01-02-2006_150405")
+	timeSuffix := f.generatedAt.Format("01-02-2006_150405")
 
 	ext := filepath.Ext(outputFilePath)
 	base := outputFilePath[:len(outputFilePath)-len(ext)]
-	outputFilePath = fmt.Sprintf("%s-%s%s", base, timeSuffix, ext)
+	outputFilePath = fmt.Sprintf("%s%s-%s%s", base, tag, timeSuffix, ext)
 
 	outputDir := filepath.Dir(outputFilePath)
 	err := os.MkdirAll(outputDir, os.ModePerm)
 	cobra.CheckErr(err)
 
+	return outputFilePath
+}
+
+func GenerateHTML(f *FinalResult) {
+	outputFilePath := reportPath(f, "")
+
 	outputFile, err := os.Create(outputFilePath)
 	cobra.CheckErr(err)
 	defer outputFile.Close()
@@ -481,6 +901,17 @@ func GenerateHTML(f *FinalResult) {
 			background-color: #ccc;
 		}
 		  
+		.metrics {
+			border-collapse: collapse;
+			margin: 0 0 1em 0;
+		}
+
+		.metrics th, .metrics td {
+			border: 1px solid #ccc;
+			padding: 4px 8px;
+			text-align: right;
+		}
+
 		.collapsible {
 			background-color: #eee;
 			color: #444;
@@ -512,41 +943,75 @@ func GenerateHTML(f *FinalResult) {
 		}
 	`
 
+	// graded runs show every output next to its grade, not only the failures
 	detailsDiv := Div(H2("Failed Test Details"))
+	if grader != nil {
+		detailsDiv = Div(H2("Graded Test Details"))
+	}
 
 	for _, result := range f.results {
+		// Iff renders lazily, so each result needs its own variable
+		result := result
 		switch data := result.GetData().(type) {
 		case *DataEntry:
-			if result.GetPassed() == data.passed {
+			if resultCorrect(result) && result.GetGrade() == nil {
 				continue
 			}
 
 			resultParagraph := P(
-				Textf("User-Passed: %t", data.passed),
+				Textf("Expected: %s", expectedLabel(data)),
 				Br(),
-				Textf("Passed: %t", result.GetPassed()),
+				Textf("Verdict: %s", verdictText(result)),
 				Br(),
 				Textf("Diff Delta: %s", data.diffDelta),
 				Br(),
 				Textf("LLM: %s", result.GetLLM()),
 				Br(),
+				Iff(len(result.GetSamples()) > 1, func() HTMLComponent {
+					return Components(samplesText(result), Br())
+				}),
+				Iff(result.GetGrade() != nil, func() HTMLComponent {
+					return gradeText(result.GetGrade())
+				}),
+				Iff(len(result.GetRationale()) > 0, func() HTMLComponent {
+					return Textf("LLM Rationale: %s", result.GetRationale())
+				}),
+			)
+
+			dataDiv := Div(
+				Button("LLM Response").Type("button").Class("collapsible"),
+				Div(
+					Pre(result.GetResponse()),
+				).Class("content"),
+				Hr(),
 			)
+
 			detailsDiv.AppendChildren(resultParagraph)
+			detailsDiv.AppendChildren(dataDiv)
 		case *PseudoDataEntry:
-			if result.GetPassed() == data.passed {
+			if resultCorrect(result) && result.GetGrade() == nil {
 				continue
 			}
 
 			resultParagraph := P(
-				Textf("LLM: %s said %t", result.GetLLM(), result.GetPassed()),
+				Textf("LLM: %s said %s", result.GetLLM(), verdictText(result)),
 				Br(),
-				Textf("Expected Result: %t", data.passed),
+				Textf("Expected Result: %s", expectedLabel(data)),
 				Br(),
+				Iff(len(result.GetSamples()) > 1, func() HTMLComponent {
+					return Components(samplesText(result), Br())
+				}),
+				Iff(result.GetGrade() != nil, func() HTMLComponent {
+					return gradeText(result.GetGrade())
+				}),
 				Iff(len(data.reason) > 0, func() HTMLComponent {
 					return Textf("Reason: %s", data.reason)
 				}),
-				Iff(len(result.GetResponse()) > 0, func() HTMLComponent {
-					return Textf("LLM Reason: %s", result.GetResponse())
+				Iff(len(data.reason) > 0 && len(result.GetRationale()) > 0, func() HTMLComponent {
+					return Br()
+				}),
+				Iff(len(result.GetRationale()) > 0, func() HTMLComponent {
+					return Textf("LLM Rationale: %s", result.GetRationale())
 				}),
 			)
 
@@ -559,6 +1024,10 @@ func GenerateHTML(f *FinalResult) {
 				Div(
 					Pre(data.patch),
 				).Class("content"),
+				Button("LLM Response").Type("button").Class("collapsible"),
+				Div(
+					Pre(result.GetResponse()),
+				).Class("content"),
 				Hr(),
 			)
 
@@ -566,6 +1035,9 @@ func GenerateHTML(f *FinalResult) {
 			detailsDiv.AppendChildren(dataDiv)
 		}
 	}
+	if f.omitted > 0 && runLog != nil {
+		detailsDiv.AppendChildren(P(Textf("%d more results are only in the result log: %s", f.omitted, runLog.path)))
+	}
 
 	comp := HTML(
 		Head(
@@ -581,6 +1053,7 @@ func GenerateHTML(f *FinalResult) {
 			P(
 				Textf("%d tests ran in %v\n", f.total, f.seconds),
 			),
+			selectionParagraph(f),
 			P(
 				Textf("Passed: %d", f.passed),
 				Br(),
@@ -595,9 +1068,15 @@ func GenerateHTML(f *FinalResult) {
 				Br(),
 				Textf("Score excluding inconclusives: %.2f%%", f.percentageNoInconclusives),
 				Br(),
+				Iff(f.meanScore != nil, func() HTMLComponent {
+					return Components(Textf("Mean grader score: %.3f", *f.meanScore), Br())
+				}),
 			),
+			modelsParagraph(f),
+			paramsParagraph(),
 
 			detailsDiv,
+			flakyDiv(f),
 		),
 		Script(script),
 	)
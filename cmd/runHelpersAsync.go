@@ -1,11 +1,8 @@
 package cmd
 
 import (
-	"encoding/csv"
 	"errors"
 	"fmt"
-	"os"
-	"strings"
 	"sync"
 	"time"
 
@@ -15,7 +12,7 @@ import (
 )
 
 type Job struct {
-	llmsObj           *LLMs
+	provider          Provider
 	dataEntry         interface{}
 	constructedPrompt string
 }
@@ -32,9 +29,9 @@ func worker(jobs <-chan Job, results chan<- *GlobalResult, bar *progressbar.Prog
 					}
 					time.Sleep(rateLimitError.retryAfter)
 					continue
-				} else {
-					cobra.CompErrorln(err.Error())
 				}
+				// fails the run like the sync path, rather than dropping the job
+				cobra.CheckErr(err)
 			} else {
 				results <- res
 				bar.Add(1)
@@ -45,77 +42,43 @@ func worker(jobs <-chan Job, results chan<- *GlobalResult, bar *progressbar.Prog
 }
 
 func processJob(job Job) (*GlobalResult, error) {
-	var res GlobalResult
-
-	switch v := job.dataEntry.(type) {
-	case DataEntry:
-		res = &Result{}
-		res.SetData(&v)
-	case PseudoDataEntry:
-		res = &PseudoResult{}
-		res.SetData(&v)
-	default:
+	res := newResult(job.dataEntry)
+	if res == nil {
 		return nil, fmt.Errorf("Invalid type passed to processJob()")
 	}
 
-	if job.llmsObj.openAi != nil {
-		res.SetLLM(job.llmsObj.openAi.llm)
-		response, err := GetGPTResponse(job.llmsObj.openAi.client, job.constructedPrompt, job.llmsObj.openAi.llm)
-		if err != nil {
-			return nil, err
-		}
-
-		if strings.ToLower(response) == "true" {
-			res.SetPassed(true)
-		} else if strings.ToLower(response) == "false" {
-			res.SetPassed(false)
-		} else {
-			res.SetResponse(response)
-		}
-
-		return &res, nil
+	res.SetLLM(job.provider.Model())
+	responses, err := completeSamples(job.provider, job.dataEntry, job.constructedPrompt)
+	if err != nil {
+		return nil, err
 	}
 
-	if job.llmsObj.anthropic != nil {
-		res.SetLLM(job.llmsObj.anthropic.llm)
-		response, err := GetClaudeResponse(job.llmsObj.anthropic.client, job.constructedPrompt, job.llmsObj.anthropic.llm)
-		if err != nil {
-			return nil, err
-		}
-
-		if strings.ToLower(response) == "true" {
-			res.SetPassed(true)
-		} else if strings.ToLower(response) == "false" {
-			res.SetPassed(false)
-		} else {
-			res.SetResponse(response)
-		}
-
-		return &res, nil
+	if err := applySamples(res, responses); err != nil {
+		return nil, err
 	}
 
-	return nil, nil
+	return &res, nil
 }
 
-func SubmitDataAsync(workerCount int) ([]GlobalResult, time.Duration) {
+func SubmitDataAsync(workerCount int) (*runTotals, time.Duration) {
 	start := time.Now()
 
 	llmsObj := InitLLMs()
-	var resultsList []GlobalResult
+	defer llmsObj.Close()
 
 	dataFile := viper.GetString("dataFile")
 	if dataFile == "" {
 		return nil, time.Since(start)
 	}
 
-	f, err := os.Open(dataFile)
-	cobra.CheckErr(err)
-	defer f.Close()
-
-	r, err := csv.NewReader(f).ReadAll()
-	cobra.CheckErr(err)
+	selection, log, totals, bar := startRun(llmsObj, func(offer func(interface{})) error {
+		return eachDataEntry(dataFile, func(e DataEntry) error {
+			offer(e)
+			return nil
+		})
+	})
+	defer log.Close()
 
-	bar := progressbar.Default(int64(len(r))-1, "running tests")
 	jobs := make(chan Job, workerCount)
 	results := make(chan *GlobalResult)
 	var wg sync.WaitGroup
@@ -128,32 +91,37 @@ func SubmitDataAsync(workerCount int) ([]GlobalResult, time.Duration) {
 		}()
 	}
 
+	// jobs holds at most workerCount jobs, so the dataset is read only as
+	// fast as the workers take them
 	go func() {
-		for _, record := range r {
-			if record[0] == "passed" {
-				continue
+		err := eachDataEntry(dataFile, func(e DataEntry) error {
+			if !selection.selected(e) {
+				return nil
 			}
 
-			var e DataEntry
-			e.passed = strings.ToLower(record[0]) == "true"
-			e.diffDelta, err = Base64Decode(record[1])
-			cobra.CheckErr(err)
-
-			constructedPrompt := createPrompt(e.diffDelta)
-			jobs <- Job{llmsObj, e, constructedPrompt}
-		}
+			constructedPrompt := createPrompt(e, e.diffDelta)
+			for _, provider := range llmsObj.providers {
+				jobs <- Job{provider, e, constructedPrompt}
+			}
+			return nil
+		})
+		cobra.CheckErr(err)
 		close(jobs)
 	}()
 
+	done := make(chan struct{})
 	go func() {
 		for res := range results {
-			resultsList = append(resultsList, *res)
+			log.add(*res)
+			totals.add(*res)
 		}
+		close(done)
 	}()
 
 	wg.Wait()
 	close(results)
+	<-done
 
 	seconds := time.Since(start)
-	return resultsList, seconds
+	return totals, seconds
 }
@@ -0,0 +1,227 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+type exportReport struct {
+	GeneratedAt               time.Time                    `json:"generatedAt"`
+	Seconds                   float64                      `json:"seconds"`
+	Total                     int                          `json:"total"`
+	Passed                    int                          `json:"passed"`
+	Failed                    int                          `json:"failed"`
+	Inconclusive              int                          `json:"inconclusive"`
+	Percentage                float64                      `json:"percentage"`
+	PercentageNoInconclusives float64                      `json:"percentageNoInconclusives"`
+	MeanScore                 *float64                     `json:"meanScore,omitempty"`
+	Selection                 *rowSelection                `json:"selection,omitempty"`
+	Params                    map[string]*GenerationParams `json:"params"`
+	Models                    []modelSummary               `json:"models"`
+	Comparisons               []modelComparison            `json:"comparisons"`
+	Results                   []exportResult               `json:"results"`
+}
+
+type exportResult struct {
+	Row          int               `json:"row"`
+	ID           string            `json:"id,omitempty"`
+	LLM          string            `json:"llm"`
+	Expected     string            `json:"expected"`
+	Verdict      string            `json:"verdict"`
+	Correct      bool              `json:"correct"`
+	Inconclusive bool              `json:"inconclusive"`
+	Samples      []string          `json:"samples,omitempty"`
+	Agreement    float64           `json:"agreement"`
+	Flaky        bool              `json:"flaky"`
+	Grade        *Grade            `json:"grade,omitempty"`
+	Rationale    string            `json:"rationale"`
+	Response     string            `json:"response"`
+	Data         map[string]string `json:"data"`
+}
+
+func newExportResult(result GlobalResult) exportResult {
+	expected := expectedLabel(result.GetData())
+
+	return exportResult{
+		Row:          entryRow(result.GetData()),
+		ID:           entryFields(result.GetData())["id"],
+		LLM:          result.GetLLM(),
+		Expected:     expected,
+		Verdict:      result.GetVerdict(),
+		Correct:      resultCorrect(result),
+		Inconclusive: result.GetInconclusive(),
+		Samples:      result.GetSamples(),
+		Agreement:    sampleAgreement(result.GetSamples()),
+		Flaky:        isFlaky(result.GetSamples()),
+		Grade:        result.GetGrade(),
+		Rationale:    result.GetRationale(),
+		Response:     result.GetResponse(),
+		Data:         entryFields(result.GetData()),
+	}
+}
+
+// ReadExport loads a report written by WriteExport.
+func ReadExport(path string) (*exportReport, error) {
+	data, err := os.ReadFile(os.ExpandEnv(path))
+	if err != nil {
+		return nil, err
+	}
+
+	var report exportReport
+	if err := json.Unmarshal(data, &report); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	return &report, nil
+}
+
+// WriteExport writes the run summary and every result as JSON. Results are
+// read back from the run's result log, since a run keeps only its totals and
+// the results the report details in memory.
+func WriteExport(f *FinalResult, path string) {
+	report := exportReport{
+		GeneratedAt:               f.generatedAt,
+		Seconds:                   f.seconds.Seconds(),
+		Total:                     f.total,
+		Passed:                    f.passed,
+		Failed:                    f.failed,
+		Inconclusive:              f.inconclusive,
+		Percentage:                f.percentage,
+		PercentageNoInconclusives: f.percentageNoInconclusives,
+		MeanScore:                 f.meanScore,
+		Selection:                 f.selection,
+		Params:                    modelParams,
+		Models:                    f.models,
+		Comparisons:               f.comparisons,
+	}
+
+	path = os.ExpandEnv(path)
+	err := os.MkdirAll(filepath.Dir(path), os.ModePerm)
+	cobra.CheckErr(err)
+
+	file, err := os.Create(path)
+	cobra.CheckErr(err)
+	defer file.Close()
+
+	// results are streamed in place of the null that ends the summary
+	summary, err := json.MarshalIndent(report, "", "  ")
+	cobra.CheckErr(err)
+	if !bytes.HasSuffix(summary, []byte(`"results": null`+"\n}")) {
+		cobra.CheckErr(errors.New("export: summary does not end with its results"))
+	}
+	_, err = file.Write(bytes.TrimSuffix(summary, []byte("null\n}")))
+	cobra.CheckErr(err)
+
+	written := 0
+	write := func(result exportResult) error {
+		data, err := json.MarshalIndent(result, "    ", "  ")
+		if err != nil {
+			return err
+		}
+		separator := ",\n    "
+		if written == 0 {
+			separator = "[\n    "
+		}
+		written++
+		_, err = file.Write(append([]byte(separator), data...))
+		return err
+	}
+
+	if runLog != nil {
+		err = runLog.each(write)
+		cobra.CheckErr(err)
+	}
+
+	end := "\n  ]\n}"
+	if written == 0 {
+		end = "[]\n}"
+	}
+	_, err = file.WriteString(end)
+	cobra.CheckErr(err)
+	fmt.Println("Results exported to:", path)
+}
+
+// runLog is the result log of the current run.
+var runLog *resultLog
+
+// resultLog appends each result of a run to a jsonl file, as an exportResult
+// per line, as soon as it completes. A run that crashes keeps the results it
+// finished, and the export reads them back instead of holding them in memory.
+type resultLog struct {
+	path string
+	file *os.File
+}
+
+// openResultLog creates the result log of a run at --results, or else at a
+// new timestamped file in resultsDir that no other run shares.
+func openResultLog() *resultLog {
+	var file *os.File
+	var err error
+
+	if path := viper.GetString("results"); path != "" {
+		path = os.ExpandEnv(path)
+		err = os.MkdirAll(filepath.Dir(path), os.ModePerm)
+		cobra.CheckErr(err)
+
+		file, err = os.Create(path)
+	} else {
+		dir := viper.GetString("resultsDir")
+		if dir == "" {
+			dir = "$HOME/.score/results"
+		}
+		dir = os.ExpandEnv(dir)
+		err = os.MkdirAll(dir, os.ModePerm)
+		cobra.CheckErr(err)
+
+		file, err = os.CreateTemp(dir, fmt.Sprintf("results-%s-*.jsonl", time.Now().Format("01-02-2006_150405")))
+	}
+	cobra.CheckErr(err)
+
+	path := file.Name()
+	fmt.Println("Logging results to:", path)
+
+	runLog = &resultLog{path: path, file: file}
+	return runLog
+}
+
+// add logs a result.
+func (l *resultLog) add(result GlobalResult) {
+	data, err := json.Marshal(newExportResult(result))
+	cobra.CheckErr(err)
+
+	_, err = l.file.Write(append(data, '\n'))
+	cobra.CheckErr(err)
+}
+
+// each reads the logged results back in order.
+func (l *resultLog) each(fn func(exportResult) error) error {
+	file, err := os.Open(l.path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	scanner := newJSONLScanner(file)
+	for scanner.Scan() {
+		var result exportResult
+		if err := json.Unmarshal(scanner.Bytes(), &result); err != nil {
+			return fmt.Errorf("%s: %w", l.path, err)
+		}
+		if err := fn(result); err != nil {
+			return err
+		}
+	}
+	return scanner.Err()
+}
+
+func (l *resultLog) Close() {
+	cobra.CheckErr(l.file.Close())
+}
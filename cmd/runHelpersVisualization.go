@@ -6,42 +6,9 @@ import (
 
 	"github.com/go-echarts/go-echarts/v2/charts"
 	"github.com/go-echarts/go-echarts/v2/opts"
-	"github.com/spf13/viper"
+	"github.com/spf13/cobra"
 )
 
-// TODO: visualization is a WIP
-func generateBarItems(results []GlobalResult, llm string) (int, int, int) {
-	passed, failed, inconclusive := 0, 0, 0
-
-	for _, v := range results {
-		if v.GetLLM() == llm {
-
-			if v.GetResponse() == "" {
-				switch d := v.GetData().(type) {
-				case Result:
-					if v.GetPassed() == d.passed {
-						passed++
-					} else {
-						failed++
-					}
-				case PseudoResult:
-					if v.GetPassed() == d.passed {
-						passed++
-					} else {
-						failed++
-					}
-				}
-			} else {
-				inconclusive++
-			}
-		} else {
-			inconclusive++
-		}
-	}
-
-	return passed, failed, inconclusive
-}
-
 func GenerateBarChart(finalResult *FinalResult) {
 	bar := charts.NewBar()
 
@@ -51,16 +18,16 @@ func GenerateBarChart(finalResult *FinalResult) {
 			finalResult.percentage, finalResult.percentageNoInconclusives, finalResult.seconds.Seconds()),
 	}))
 
-	llmModels := []string{"gpt-4", "claude-3-opus-20240229"} // TODO: make this dynamic
+	llmModels := make([]string, 0, len(finalResult.models))
 	passedItems := make([]opts.BarData, 0)
 	failedItems := make([]opts.BarData, 0)
 	inconclusiveItems := make([]opts.BarData, 0)
 
-	for _, llm := range llmModels {
-		passed, failed, inconclusive := generateBarItems(finalResult.results, llm)
-		passedItems = append(passedItems, opts.BarData{Value: passed})
-		failedItems = append(failedItems, opts.BarData{Value: failed})
-		inconclusiveItems = append(inconclusiveItems, opts.BarData{Value: inconclusive})
+	for _, model := range finalResult.models {
+		llmModels = append(llmModels, model.LLM)
+		passedItems = append(passedItems, opts.BarData{Value: model.Passed})
+		failedItems = append(failedItems, opts.BarData{Value: model.Failed})
+		inconclusiveItems = append(inconclusiveItems, opts.BarData{Value: model.Inconclusive})
 	}
 
 	bar.SetXAxis(llmModels).
@@ -68,8 +35,13 @@ func GenerateBarChart(finalResult *FinalResult) {
 		AddSeries("Failed", failedItems).
 		AddSeries("Inconclusive", inconclusiveItems)
 
-	outputFile := viper.GetString("outputFile")
+	outputFilePath := reportPath(finalResult, "-chart")
+
+	f, err := os.Create(outputFilePath)
+	cobra.CheckErr(err)
+	defer f.Close()
 
-	f, _ := os.Create(outputFile)
-	bar.Render(f)
+	err = bar.Render(f)
+	cobra.CheckErr(err)
+	fmt.Println("Chart written to:", outputFilePath)
 }
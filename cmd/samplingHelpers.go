@@ -0,0 +1,116 @@
+package cmd
+
+import (
+	"context"
+
+	"github.com/spf13/viper"
+)
+
+const inconclusiveLabel = "inconclusive"
+
+func getSamples() int {
+	samples := viper.GetInt("samples")
+	if samples < 1 {
+		return 1
+	}
+	return samples
+}
+
+// completeSamples queries a provider --samples times for the same row. Each
+// sample is a separate request so caches and cassettes keep them apart.
+func completeSamples(provider Provider, e interface{}, constructedPrompt string) ([]*CompletionResponse, error) {
+	samples := getSamples()
+	responses := make([]*CompletionResponse, 0, samples)
+
+	for i := 0; i < samples; i++ {
+		req := newCompletionRequest(provider, e, constructedPrompt)
+		req.Sample = i
+
+		response, err := processWithRetries(func() (*CompletionResponse, error) {
+			return provider.Complete(context.Background(), req)
+		})
+		if err != nil {
+			return nil, err
+		}
+		responses = append(responses, response)
+	}
+
+	return responses, nil
+}
+
+// applySamples sets the majority verdict of the responses on the result. The
+// response, rationale and grade shown are those of the first sample agreeing
+// with the majority. Inconclusive samples vote too, so a verdict needs more
+// samples than any other label including inconclusive, and a tie between the
+// most common labels is inconclusive.
+func applySamples(res GlobalResult, responses []*CompletionResponse) error {
+	labels := make([]string, len(responses))
+	grades := make([]*Grade, len(responses))
+	votes := make(map[string]int)
+	for i, response := range responses {
+		verdict, ok, grade, err := gradeResponse(res.GetData(), response.Content)
+		if err != nil {
+			return err
+		}
+		grades[i] = grade
+		labels[i] = inconclusiveLabel
+		if ok {
+			labels[i] = verdict
+		}
+		votes[labels[i]]++
+	}
+
+	majority, most := inconclusiveLabel, 0
+	for label, count := range votes {
+		if count > most {
+			majority, most = label, count
+		} else if count == most {
+			majority = inconclusiveLabel
+		}
+	}
+
+	chosen := 0
+	for i, label := range labels {
+		if label == majority {
+			chosen = i
+			break
+		}
+	}
+
+	applyResponse(res, responses[chosen], labels[chosen], grades[chosen])
+	if majority == inconclusiveLabel {
+		res.SetPassed(false)
+		res.SetVerdict("")
+		res.SetInconclusive(true)
+	}
+
+	res.SetSamples(labels)
+	return nil
+}
+
+// sampleAgreement is the share of samples that gave the most common verdict.
+func sampleAgreement(samples []string) float64 {
+	if len(samples) == 0 {
+		return 1
+	}
+
+	counts := make(map[string]int)
+	most := 0
+	for _, label := range samples {
+		counts[label]++
+		if counts[label] > most {
+			most = counts[label]
+		}
+	}
+	return float64(most) / float64(len(samples))
+}
+
+// isFlaky reports whether a row's verdict changed between samples.
+func isFlaky(samples []string) bool {
+	for _, label := range samples {
+		if label != samples[0] {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,307 @@
+package cmd
+
+import (
+	"bufio"
+	"fmt"
+	"math"
+	"math/rand"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/spf13/viper"
+)
+
+// rowSelection picks the dataset rows a run submits: those matching every
+// --filter and listed in --ids, then optionally a random sample of them that
+// --seed makes reproducible. Sampling with --stratify-by keeps the share of
+// each combination of the columns' values, e.g.
+//
+//	score run pseudo -d pseudo.csv --sample 50 --stratify-by lesson,vuln
+//
+// Rows are offered while the dataset is first read and chosen before any is
+// submitted, so only their row numbers and strata are held.
+type rowSelection struct {
+	Total      int            `json:"total"`
+	Selected   int            `json:"selected"`
+	Filters    []string       `json:"filters,omitempty"`
+	IDs        string         `json:"ids,omitempty"`
+	Sample     int            `json:"sample,omitempty"`
+	SampleFrac float64        `json:"sampleFrac,omitempty"`
+	Seed       int64          `json:"seed"`
+	StratifyBy []string       `json:"stratifyBy,omitempty"`
+	Strata     map[string]int `json:"strata,omitempty"`
+
+	filters    []rowFilter
+	columns    map[string]bool
+	ids        map[string]bool
+	candidates []selectionCandidate
+	rows       map[int]bool
+}
+
+// rowFilter is a --filter of the form column==value or column!=value.
+// Values are compared ignoring case and surrounding whitespace.
+type rowFilter struct {
+	column string
+	value  string
+	equal  bool
+}
+
+type selectionCandidate struct {
+	row     int
+	stratum string
+}
+
+// runSelection is the row selection of the current run, or nil when every
+// row runs.
+var runSelection *rowSelection
+
+func newRowSelection() (*rowSelection, error) {
+	s := rowSelection{
+		Filters:    viper.GetStringSlice("filters"),
+		IDs:        viper.GetString("ids"),
+		Sample:     viper.GetInt("sample"),
+		SampleFrac: viper.GetFloat64("sampleFrac"),
+		Seed:       viper.GetInt64("seed"),
+		StratifyBy: viper.GetStringSlice("stratifyBy"),
+		columns:    make(map[string]bool),
+	}
+
+	switch {
+	case s.Sample < 0:
+		return nil, fmt.Errorf("--sample must be positive")
+	case s.SampleFrac < 0 || s.SampleFrac > 1:
+		return nil, fmt.Errorf("--sample-frac must be between 0 and 1")
+	case s.Sample > 0 && s.SampleFrac > 0:
+		return nil, fmt.Errorf("use either --sample or --sample-frac")
+	case len(s.StratifyBy) > 0 && !s.sampled():
+		return nil, fmt.Errorf("--stratify-by needs --sample or --sample-frac")
+	}
+
+	for _, filter := range s.Filters {
+		f, err := parseRowFilter(filter)
+		if err != nil {
+			return nil, err
+		}
+		s.filters = append(s.filters, f)
+	}
+
+	if s.IDs != "" {
+		ids, err := readIDs(s.IDs)
+		if err != nil {
+			return nil, err
+		}
+		s.ids = ids
+	}
+
+	runSelection = nil
+	if s.active() {
+		runSelection = &s
+	}
+	return &s, nil
+}
+
+func parseRowFilter(filter string) (rowFilter, error) {
+	for _, op := range []string{"==", "!="} {
+		column, value, ok := strings.Cut(filter, op)
+		if ok && strings.TrimSpace(column) != "" {
+			return rowFilter{column: strings.TrimSpace(column), value: strings.TrimSpace(value), equal: op == "=="}, nil
+		}
+	}
+	return rowFilter{}, fmt.Errorf("invalid --filter %q, expected column==value or column!=value", filter)
+}
+
+// readIDs reads an --ids file of one id per line. Blank lines and lines
+// starting with # are skipped.
+func readIDs(path string) (map[string]bool, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	ids := make(map[string]bool)
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		id := strings.TrimSpace(scanner.Text())
+		if id != "" && !strings.HasPrefix(id, "#") {
+			ids[id] = true
+		}
+	}
+	return ids, scanner.Err()
+}
+
+func (s *rowSelection) active() bool {
+	return len(s.filters) > 0 || s.ids != nil || s.sampled()
+}
+
+func (s *rowSelection) sampled() bool {
+	return s.Sample > 0 || s.SampleFrac > 0
+}
+
+// offer considers a data entry for the selection.
+func (s *rowSelection) offer(e interface{}) {
+	s.Total++
+	if !s.active() {
+		return
+	}
+
+	// columns are noted for every filter, even past one the row fails, so a
+	// column is only reported missing when no row has it
+	fields := entryFields(e)
+	for _, f := range s.filters {
+		if _, ok := fields[f.column]; ok {
+			s.columns[f.column] = true
+		}
+	}
+	for _, f := range s.filters {
+		if strings.EqualFold(strings.TrimSpace(fields[f.column]), f.value) != f.equal {
+			return
+		}
+	}
+
+	// rows without an id are listed by row number
+	if s.ids != nil {
+		id := fields["id"]
+		if id == "" {
+			id = strconv.Itoa(entryRow(e))
+		}
+		if !s.ids[id] {
+			return
+		}
+	}
+
+	var stratum []string
+	for _, column := range s.StratifyBy {
+		stratum = append(stratum, column+"="+fields[column])
+	}
+	s.candidates = append(s.candidates, selectionCandidate{row: entryRow(e), stratum: strings.Join(stratum, ", ")})
+}
+
+// choose picks the rows to run from those offered and returns how many there
+// are.
+func (s *rowSelection) choose() (int, error) {
+	if !s.active() {
+		s.Selected = s.Total
+		return s.Selected, nil
+	}
+
+	for _, f := range s.filters {
+		if !s.columns[f.column] && s.Total > 0 {
+			return 0, fmt.Errorf("--filter column %q is not in the dataset", f.column)
+		}
+	}
+
+	n := len(s.candidates)
+	switch {
+	case s.Sample > 0:
+		n = min(s.Sample, n)
+	case s.SampleFrac > 0:
+		n = int(math.Round(s.SampleFrac * float64(n)))
+	}
+
+	strata := make(map[string][]selectionCandidate)
+	var keys []string
+	for _, c := range s.candidates {
+		if _, ok := strata[c.stratum]; !ok {
+			keys = append(keys, c.stratum)
+		}
+		strata[c.stratum] = append(strata[c.stratum], c)
+	}
+	sort.Strings(keys)
+
+	sizes := make([]int, len(keys))
+	for i, key := range keys {
+		sizes[i] = len(strata[key])
+	}
+	quotas := allocate(n, sizes)
+
+	rng := rand.New(rand.NewSource(s.Seed))
+	s.rows = make(map[int]bool)
+	if len(s.StratifyBy) > 0 {
+		s.Strata = make(map[string]int)
+	}
+	for i, key := range keys {
+		group := strata[key]
+		if quotas[i] < len(group) {
+			rng.Shuffle(len(group), func(a, b int) { group[a], group[b] = group[b], group[a] })
+		}
+		for _, c := range group[:quotas[i]] {
+			s.rows[c.row] = true
+		}
+		if s.Strata != nil {
+			s.Strata[key] = quotas[i]
+		}
+	}
+
+	s.candidates = nil
+	s.Selected = len(s.rows)
+	if s.Selected == 0 && s.Total > 0 {
+		return 0, fmt.Errorf("no rows of the dataset are selected")
+	}
+	return s.Selected, nil
+}
+
+// selected is whether a data entry was chosen to run.
+func (s *rowSelection) selected(e interface{}) bool {
+	return !s.active() || s.rows[entryRow(e)]
+}
+
+// allocate splits n between groups in proportion to their sizes. Rows left
+// over from rounding down go to the groups with the largest remainders.
+func allocate(n int, sizes []int) []int {
+	total := 0
+	for _, size := range sizes {
+		total += size
+	}
+
+	quotas := make([]int, len(sizes))
+	if total == 0 {
+		return quotas
+	}
+
+	remainders := make([]float64, len(sizes))
+	order := make([]int, len(sizes))
+	left := n
+	for i, size := range sizes {
+		exact := float64(n) * float64(size) / float64(total)
+		quotas[i] = int(exact)
+		remainders[i] = exact - float64(quotas[i])
+		order[i] = i
+		left -= quotas[i]
+	}
+
+	sort.SliceStable(order, func(a, b int) bool { return remainders[order[a]] > remainders[order[b]] })
+	for _, i := range order {
+		if left == 0 {
+			break
+		}
+		if quotas[i] < sizes[i] {
+			quotas[i]++
+			left--
+		}
+	}
+	return quotas
+}
+
+func (s *rowSelection) String() string {
+	var options []string
+	for _, filter := range s.Filters {
+		options = append(options, "filter "+filter)
+	}
+	if s.IDs != "" {
+		options = append(options, "ids from "+s.IDs)
+	}
+	switch {
+	case s.Sample > 0:
+		options = append(options, fmt.Sprintf("sample of %d with seed %d", s.Sample, s.Seed))
+	case s.SampleFrac > 0:
+		options = append(options, fmt.Sprintf("sample of %g with seed %d", s.SampleFrac, s.Seed))
+	}
+	if len(s.StratifyBy) > 0 {
+		options = append(options, "stratified by "+strings.Join(s.StratifyBy, ", "))
+	}
+
+	return fmt.Sprintf("%d of %d rows selected (%s)", s.Selected, s.Total, strings.Join(options, "; "))
+}
@@ -0,0 +1,56 @@
+package cmd
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestAllocate(t *testing.T) {
+	tests := []struct {
+		n     int
+		sizes []int
+		want  []int
+	}{
+		{10, []int{5, 5}, []int{5, 5}},
+		{3, []int{1, 1, 1}, []int{1, 1, 1}},
+		{4, []int{2, 8}, []int{1, 3}},
+		{5, []int{6, 3, 1}, []int{3, 2, 0}},
+		{7, []int{1, 10}, []int{1, 6}},
+		{0, []int{4}, []int{0}},
+		{4, []int{0, 0}, []int{0, 0}},
+		{4, []int{}, []int{}},
+	}
+
+	for _, tt := range tests {
+		if got := allocate(tt.n, tt.sizes); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("allocate(%d, %v) = %v, want %v", tt.n, tt.sizes, got, tt.want)
+		}
+	}
+}
+
+func TestParseRowFilter(t *testing.T) {
+	tests := []struct {
+		filter  string
+		want    rowFilter
+		wantErr bool
+	}{
+		{filter: "lang==go", want: rowFilter{column: "lang", value: "go", equal: true}},
+		{filter: " lang != go ", want: rowFilter{column: "lang", value: "go", equal: false}},
+		{filter: "lang==", want: rowFilter{column: "lang", value: "", equal: true}},
+		{filter: "note==a!=b", want: rowFilter{column: "note", value: "a!=b", equal: true}},
+		{filter: "==go", wantErr: true},
+		{filter: "lang=go", wantErr: true},
+		{filter: "", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		got, err := parseRowFilter(tt.filter)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("parseRowFilter(%q) error = %v, want error %v", tt.filter, err, tt.wantErr)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("parseRowFilter(%q) = %+v, want %+v", tt.filter, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,314 @@
+package cmd
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"strings"
+	"unicode"
+
+	"github.com/spf13/viper"
+)
+
+// similarityGrader compares a response to the dataset's reference answer
+// without calling a model:
+//
+//	grader:
+//	  type: rougeL
+//	  referenceColumn: answer
+//	  threshold: 0.4
+//
+// Types are exact, normalized (ignoring case, whitespace and punctuation),
+// levenshtein, tokenF1, rougeL and bleu. Scores are between 0 and 1 and pass
+// at grader.threshold, 0.5 by default.
+type similarityGrader struct {
+	name      string
+	score     func(response, reference string) float64
+	threshold float64
+}
+
+var similarityMetrics = map[string]func(response, reference string) float64{
+	"exact":       exactMatch,
+	"normalized":  normalizedMatch,
+	"levenshtein": levenshteinRatio,
+	"tokenF1":     tokenF1,
+	"rougeL":      rougeL,
+	"bleu":        bleu,
+}
+
+func newSimilarityGrader(name string) (*similarityGrader, error) {
+	if viper.GetString(graderKey("referenceColumn")) == "" {
+		return nil, fmt.Errorf("grader.type %s needs a grader.referenceColumn", name)
+	}
+
+	return &similarityGrader{
+		name:      name,
+		score:     similarityMetrics[name],
+		threshold: graderThreshold(0.5),
+	}, nil
+}
+
+func (s *similarityGrader) Labeled() bool {
+	return false
+}
+
+func (s *similarityGrader) Name() string {
+	return s.name
+}
+
+func (s *similarityGrader) Grade(e interface{}, response string) (*Grade, error) {
+	score := s.score(response, referenceAnswer(e))
+	return &Grade{
+		Grader: s.name,
+		Score:  score,
+		Passed: score >= s.threshold,
+	}, nil
+}
+
+// regexGrader checks a response against patterns:
+//
+//	grader:
+//	  type: regex
+//	  mustMatch: ['(?i)sql injection']
+//	  mustNotMatch: ['(?i)no vulnerabilit']
+//
+// Without mustMatch patterns, the reference answer is the pattern to match.
+// The score is the share of patterns the response satisfies, and the response
+// passes when all of them are satisfied unless grader.threshold is lower.
+type regexGrader struct {
+	mustMatch    []*regexp.Regexp
+	mustNotMatch []*regexp.Regexp
+	reference    bool
+	threshold    float64
+}
+
+func newRegexGrader() (*regexGrader, error) {
+	r := regexGrader{threshold: graderThreshold(1)}
+
+	for _, pattern := range viper.GetStringSlice(graderKey("mustMatch")) {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid grader.mustMatch %q: %w", pattern, err)
+		}
+		r.mustMatch = append(r.mustMatch, re)
+	}
+	for _, pattern := range viper.GetStringSlice(graderKey("mustNotMatch")) {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid grader.mustNotMatch %q: %w", pattern, err)
+		}
+		r.mustNotMatch = append(r.mustNotMatch, re)
+	}
+
+	if len(r.mustMatch) == 0 {
+		if viper.GetString(graderKey("referenceColumn")) == "" {
+			return nil, fmt.Errorf("grader.type regex needs grader.mustMatch patterns or a grader.referenceColumn")
+		}
+		r.reference = true
+	}
+
+	return &r, nil
+}
+
+func (r *regexGrader) Labeled() bool {
+	return false
+}
+
+func (r *regexGrader) Name() string {
+	return "regex"
+}
+
+func (r *regexGrader) Grade(e interface{}, response string) (*Grade, error) {
+	mustMatch := r.mustMatch
+	if r.reference {
+		re, err := regexp.Compile(referenceAnswer(e))
+		if err != nil {
+			return &Grade{Grader: r.Name(), Inconclusive: true, Rationale: fmt.Sprintf("invalid reference pattern: %v", err)}, nil
+		}
+		mustMatch = []*regexp.Regexp{re}
+	}
+
+	var problems []string
+	for _, re := range mustMatch {
+		if !re.MatchString(response) {
+			problems = append(problems, fmt.Sprintf("does not match /%s/", re))
+		}
+	}
+	for _, re := range r.mustNotMatch {
+		if re.MatchString(response) {
+			problems = append(problems, fmt.Sprintf("matches /%s/", re))
+		}
+	}
+
+	total := len(mustMatch) + len(r.mustNotMatch)
+	score := ratio(float64(total-len(problems)), float64(total))
+	return &Grade{
+		Grader:    r.Name(),
+		Score:     score,
+		Passed:    score >= r.threshold,
+		Rationale: strings.Join(problems, "; "),
+	}, nil
+}
+
+func graderThreshold(fallback float64) float64 {
+	if key := graderKey("threshold"); viper.IsSet(key) {
+		return viper.GetFloat64(key)
+	}
+	return fallback
+}
+
+func exactMatch(response, reference string) float64 {
+	return boolScore(strings.TrimSpace(response) == strings.TrimSpace(reference))
+}
+
+func normalizedMatch(response, reference string) float64 {
+	return boolScore(normalizeText(response) == normalizeText(reference))
+}
+
+// normalizeText lowercases text, drops punctuation and collapses whitespace.
+func normalizeText(text string) string {
+	return strings.Join(textTokens(text), " ")
+}
+
+func textTokens(text string) []string {
+	text = strings.Map(func(r rune) rune {
+		if unicode.IsPunct(r) || unicode.IsSymbol(r) {
+			return ' '
+		}
+		return unicode.ToLower(r)
+	}, text)
+	return strings.Fields(text)
+}
+
+// levenshteinRatio is one minus the edit distance between the texts divided
+// by the length of the longer one, in runes.
+func levenshteinRatio(response, reference string) float64 {
+	a, b := []rune(strings.TrimSpace(response)), []rune(strings.TrimSpace(reference))
+	longest := len(a)
+	if len(b) > longest {
+		longest = len(b)
+	}
+	if longest == 0 {
+		return 1
+	}
+
+	previous := make([]int, len(b)+1)
+	current := make([]int, len(b)+1)
+	for j := range previous {
+		previous[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		current[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			current[j] = min(previous[j]+1, current[j-1]+1, previous[j-1]+cost)
+		}
+		previous, current = current, previous
+	}
+
+	return 1 - float64(previous[len(b)])/float64(longest)
+}
+
+// tokenF1 is the F1 of the normalized tokens the texts have in common,
+// counting repeated tokens as often as they appear in both.
+func tokenF1(response, reference string) float64 {
+	candidate, ref := textTokens(response), textTokens(reference)
+	if len(candidate) == 0 || len(ref) == 0 {
+		return boolScore(len(candidate) == len(ref))
+	}
+
+	counts := make(map[string]int)
+	for _, token := range ref {
+		counts[token]++
+	}
+	common := 0
+	for _, token := range candidate {
+		if counts[token] > 0 {
+			counts[token]--
+			common++
+		}
+	}
+
+	precision := float64(common) / float64(len(candidate))
+	recall := float64(common) / float64(len(ref))
+	return ratio(2*precision*recall, precision+recall)
+}
+
+// rougeL is the F1 of the longest common subsequence of normalized tokens.
+func rougeL(response, reference string) float64 {
+	candidate, ref := textTokens(response), textTokens(reference)
+	if len(candidate) == 0 || len(ref) == 0 {
+		return boolScore(len(candidate) == len(ref))
+	}
+
+	previous := make([]int, len(ref)+1)
+	current := make([]int, len(ref)+1)
+	for i := 1; i <= len(candidate); i++ {
+		for j := 1; j <= len(ref); j++ {
+			if candidate[i-1] == ref[j-1] {
+				current[j] = previous[j-1] + 1
+			} else {
+				current[j] = max(previous[j], current[j-1])
+			}
+		}
+		previous, current = current, previous
+	}
+
+	lcs := float64(previous[len(ref)])
+	precision := lcs / float64(len(candidate))
+	recall := lcs / float64(len(ref))
+	return ratio(2*precision*recall, precision+recall)
+}
+
+// bleu is the sentence-level BLEU-4 of the normalized tokens with a brevity
+// penalty. Precisions above unigrams are add-one smoothed so short responses
+// are not scored 0 for lacking 4-grams.
+func bleu(response, reference string) float64 {
+	candidate, ref := textTokens(response), textTokens(reference)
+	if len(candidate) == 0 || len(ref) == 0 {
+		return boolScore(len(candidate) == len(ref))
+	}
+
+	var logPrecision float64
+	for n := 1; n <= 4; n++ {
+		refCounts := ngramCounts(ref, n)
+		matches, total := 0, 0
+		for gram, count := range ngramCounts(candidate, n) {
+			matches += min(count, refCounts[gram])
+			total += count
+		}
+
+		if n == 1 {
+			if matches == 0 {
+				return 0
+			}
+			logPrecision += math.Log(float64(matches) / float64(total))
+		} else {
+			logPrecision += math.Log(float64(matches+1) / float64(total+1))
+		}
+	}
+
+	brevity := 1.0
+	if len(candidate) < len(ref) {
+		brevity = math.Exp(1 - float64(len(ref))/float64(len(candidate)))
+	}
+	return brevity * math.Exp(logPrecision/4)
+}
+
+func ngramCounts(tokens []string, n int) map[string]int {
+	counts := make(map[string]int)
+	for i := 0; i+n <= len(tokens); i++ {
+		counts[strings.Join(tokens[i:i+n], "\x00")]++
+	}
+	return counts
+}
+
+func boolScore(b bool) float64 {
+	if b {
+		return 1
+	}
+	return 0
+}
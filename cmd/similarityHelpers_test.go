@@ -0,0 +1,39 @@
+package cmd
+
+import (
+	"math"
+	"testing"
+)
+
+func TestSimilarityMetrics(t *testing.T) {
+	tests := []struct {
+		name      string
+		metric    func(response, reference string) float64
+		response  string
+		reference string
+		want      float64
+	}{
+		{"levenshtein identical", levenshteinRatio, "kitten", "kitten", 1},
+		{"levenshtein edits", levenshteinRatio, "kitten", "sitting", 1 - 3.0/7},
+		{"levenshtein empty", levenshteinRatio, "  ", "", 1},
+		{"levenshtein one empty", levenshteinRatio, "abc", "", 0},
+		{"levenshtein runes", levenshteinRatio, "naïve", "naive", 0.8},
+		{"rouge-l identical", rougeL, "The cat sat.", "the cat sat", 1},
+		{"rouge-l subsequence", rougeL, "the cat sat on the mat", "the cat on the mat", 10.0 / 11},
+		{"rouge-l disjoint", rougeL, "dog", "cat", 0},
+		{"rouge-l empty", rougeL, "", "", 1},
+		{"rouge-l one empty", rougeL, "cat", "", 0},
+		{"bleu identical", bleu, "the quick brown fox jumps", "the quick brown fox jumps", 1},
+		{"bleu brevity", bleu, "the cat", "the cat sat on the mat", math.Exp(-2)},
+		{"bleu no unigrams", bleu, "dog", "the cat", 0},
+		{"bleu empty", bleu, "", "", 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.metric(tt.response, tt.reference); math.Abs(got-tt.want) > 1e-9 {
+				t.Errorf("(%q, %q) = %v, want %v", tt.response, tt.reference, got, tt.want)
+			}
+		})
+	}
+}
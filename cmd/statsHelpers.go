@@ -0,0 +1,287 @@
+package cmd
+
+import (
+	"fmt"
+	"hash/fnv"
+	"math"
+	"math/rand"
+	"sort"
+
+	"github.com/spf13/viper"
+)
+
+const (
+	confidenceLevel   = 0.95
+	significanceLevel = 0.05
+)
+
+// interval is a bootstrap percentile confidence interval. It is undefined
+// when the metric is undefined in most resamples, e.g. specificity when
+// resamples rarely hold a negative row.
+type interval struct {
+	Low       float64 `json:"low"`
+	High      float64 `json:"high"`
+	Undefined bool    `json:"undefined,omitempty"`
+}
+
+// metricIntervals hold a confidence interval for each metric of a model
+// summary, on the same scale as the metric.
+type metricIntervals struct {
+	Accuracy         interval `json:"accuracy"`
+	Precision        interval `json:"precision"`
+	Recall           interval `json:"recall"`
+	F1               interval `json:"f1"`
+	Specificity      interval `json:"specificity"`
+	BalancedAccuracy interval `json:"balancedAccuracy"`
+	MCC              interval `json:"mcc"`
+}
+
+// modelComparison is an exact McNemar's test between two models over the
+// rows both of them answered. Only rows where exactly one model was correct
+// count towards the test.
+type modelComparison struct {
+	A          string  `json:"a"`
+	B          string  `json:"b"`
+	Rows       int     `json:"rows"`
+	AOnly      int     `json:"aOnlyCorrect"`
+	BOnly      int     `json:"bOnlyCorrect"`
+	Difference float64 `json:"difference"`
+	PValue     float64 `json:"pValue"`
+}
+
+// outcome is one result reduced to what the metrics need.
+type outcome struct {
+	expected     string
+	verdict      string
+	inconclusive bool
+}
+
+func (o outcome) correct() bool {
+	return !o.inconclusive && o.verdict == o.expected
+}
+
+func newOutcome(result GlobalResult) outcome {
+	return outcome{
+		expected:     expectedLabel(result.GetData()),
+		verdict:      result.GetVerdict(),
+		inconclusive: result.GetInconclusive(),
+	}
+}
+
+func getBootstrapIterations() int {
+	return viper.GetInt("bootstrap")
+}
+
+// bootstrapIntervals resamples a model's results with replacement and takes
+// the percentile interval of every metric. The resampling is seeded by the
+// model name so reports are reproducible.
+func bootstrapIntervals(llm string, outcomes outcomeCounts, iterations int) *metricIntervals {
+	// the outcomes are resampled in a fixed order, so that the draws only
+	// depend on the llm
+	kinds := make([]outcome, 0, len(outcomes))
+	for o := range outcomes {
+		kinds = append(kinds, o)
+	}
+	sort.Slice(kinds, func(i, j int) bool {
+		a, b := kinds[i], kinds[j]
+		if a.expected != b.expected {
+			return a.expected < b.expected
+		}
+		if a.verdict != b.verdict {
+			return a.verdict < b.verdict
+		}
+		return !a.inconclusive && b.inconclusive
+	})
+	total := 0
+	for _, o := range kinds {
+		total += outcomes[o]
+	}
+
+	if iterations <= 0 || total == 0 {
+		return nil
+	}
+
+	h := fnv.New64a()
+	h.Write([]byte(llm))
+	rng := rand.New(rand.NewSource(int64(h.Sum64())))
+
+	samples := make(map[string][]float64)
+	for i := 0; i < iterations; i++ {
+		// a multinomial draw of total rows, as a binomial draw per outcome
+		// from the rows and probability the previous outcomes left over
+		resample := make(outcomeCounts, len(kinds))
+		correct := 0
+		rows, left := total, total
+		for _, o := range kinds {
+			if rows == 0 {
+				break
+			}
+			n := rows
+			if outcomes[o] < left {
+				n = binomial(rng, rows, float64(outcomes[o])/float64(left))
+			}
+			rows -= n
+			left -= outcomes[o]
+			if n == 0 {
+				continue
+			}
+			resample[o] = n
+			if o.correct() {
+				correct += n
+			}
+		}
+
+		m := outcomeMetrics(resample)
+		samples["accuracy"] = append(samples["accuracy"], float64(correct)/float64(total)*100)
+		samples["precision"] = append(samples["precision"], m.Precision)
+		samples["recall"] = append(samples["recall"], m.Recall)
+		samples["f1"] = append(samples["f1"], m.F1)
+		samples["specificity"] = append(samples["specificity"], m.Specificity)
+		samples["balancedAccuracy"] = append(samples["balancedAccuracy"], m.BalancedAccuracy)
+		samples["mcc"] = append(samples["mcc"], m.MCC)
+	}
+
+	return &metricIntervals{
+		Accuracy:         percentileInterval(samples["accuracy"]),
+		Precision:        percentileInterval(samples["precision"]),
+		Recall:           percentileInterval(samples["recall"]),
+		F1:               percentileInterval(samples["f1"]),
+		Specificity:      percentileInterval(samples["specificity"]),
+		BalancedAccuracy: percentileInterval(samples["balancedAccuracy"]),
+		MCC:              percentileInterval(samples["mcc"]),
+	}
+}
+
+// binomial draws the number of successes in n trials of probability p. It
+// inverts the distribution when few successes are expected, and otherwise
+// uses the normal approximation, so its cost does not grow with n.
+func binomial(rng *rand.Rand, n int, p float64) int {
+	if p <= 0 {
+		return 0
+	}
+	if p >= 1 {
+		return n
+	}
+	if p > 0.5 {
+		return n - binomial(rng, n, 1-p)
+	}
+
+	mean := float64(n) * p
+	if mean >= 30 {
+		x := int(math.Round(mean + rng.NormFloat64()*math.Sqrt(mean*(1-p))))
+		return min(max(x, 0), n)
+	}
+
+	q := 1 - p
+	s := p / q
+	a := float64(n+1) * s
+	r := math.Pow(q, float64(n))
+	u := rng.Float64()
+	x := 0
+	for u > r && x < n {
+		u -= r
+		x++
+		r *= a/float64(x) - s
+	}
+	return x
+}
+
+// percentileInterval leaves out the resamples where the metric is undefined.
+func percentileInterval(values []float64) interval {
+	defined := values[:0]
+	for _, value := range values {
+		if !math.IsNaN(value) {
+			defined = append(defined, value)
+		}
+	}
+	if len(defined) == 0 || len(defined) < len(values)/2 {
+		return interval{Undefined: true}
+	}
+	values = defined
+
+	sort.Float64s(values)
+	tail := (1 - confidenceLevel) / 2
+	return interval{
+		Low:  values[int(math.Round(tail*float64(len(values)-1)))],
+		High: values[int(math.Round((1-tail)*float64(len(values)-1)))],
+	}
+}
+
+// mcnemar tests two models over the rows both of them answered.
+func mcnemar(a, b string, correctA, correctB map[int]bool) modelComparison {
+	comparison := modelComparison{A: a, B: b}
+
+	for row, aCorrect := range correctA {
+		bCorrect, ok := correctB[row]
+		if !ok {
+			continue
+		}
+
+		comparison.Rows++
+		if aCorrect && !bCorrect {
+			comparison.AOnly++
+		} else if bCorrect && !aCorrect {
+			comparison.BOnly++
+		}
+	}
+
+	comparison.test()
+	return comparison
+}
+
+// test sets the difference and p-value from the row counts.
+func (c *modelComparison) test() {
+	if c.Rows > 0 {
+		c.Difference = Round(float64(c.AOnly-c.BOnly)/float64(c.Rows)*100, 0.05)
+	}
+	c.PValue = mcnemarExact(c.AOnly, c.BOnly)
+}
+
+// mcnemarExact is the two-sided exact (binomial) McNemar's test on the
+// discordant pair counts.
+func mcnemarExact(b, c int) float64 {
+	n := b + c
+	if n == 0 {
+		return 1
+	}
+
+	k := b
+	if c < k {
+		k = c
+	}
+
+	lgammaN, _ := math.Lgamma(float64(n + 1))
+	p := 0.0
+	for i := 0; i <= k; i++ {
+		lgammaI, _ := math.Lgamma(float64(i + 1))
+		lgammaRest, _ := math.Lgamma(float64(n - i + 1))
+		p += math.Exp(lgammaN - lgammaI - lgammaRest - float64(n)*math.Ln2)
+	}
+
+	return math.Min(2*p, 1)
+}
+
+func (c modelComparison) significant() bool {
+	return c.PValue < significanceLevel
+}
+
+func (c modelComparison) String() string {
+	verdict := "not significant"
+	if c.significant() {
+		verdict = "significant"
+	}
+	return fmt.Sprintf("%s vs %s: %+.2f points over %d rows (%d/%d discordant), p=%.4f, %s",
+		c.A, c.B, c.Difference, c.Rows, c.AOnly, c.BOnly, c.PValue, verdict)
+}
+
+func (i interval) String() string {
+	if i.Undefined {
+		return "undefined"
+	}
+	return fmt.Sprintf("[%.3f, %.3f]", i.Low, i.High)
+}
+
+func (m metricIntervals) String() string {
+	return fmt.Sprintf("%.0f%% CI accuracy [%.2f%%, %.2f%%]  precision %s  recall %s  F1 %s  specificity %s  balanced accuracy %s  MCC %s",
+		confidenceLevel*100, m.Accuracy.Low, m.Accuracy.High, m.Precision, m.Recall, m.F1, m.Specificity, m.BalancedAccuracy, m.MCC)
+}
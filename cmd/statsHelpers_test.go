@@ -0,0 +1,67 @@
+package cmd
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+)
+
+func TestMcnemarExact(t *testing.T) {
+	tests := []struct {
+		b, c int
+		want float64
+	}{
+		{0, 0, 1},
+		{0, 5, 2.0 / 32},
+		{5, 0, 2.0 / 32},
+		{1, 9, 22.0 / 1024},
+		{2, 3, 1},
+		{5, 5, 1},
+		{0, 1, 1},
+	}
+
+	for _, tt := range tests {
+		if got := mcnemarExact(tt.b, tt.c); math.Abs(got-tt.want) > 1e-12 {
+			t.Errorf("mcnemarExact(%d, %d) = %v, want %v", tt.b, tt.c, got, tt.want)
+		}
+	}
+}
+
+func TestBinomial(t *testing.T) {
+	tests := []struct {
+		n int
+		p float64
+	}{
+		{10, 0.3},
+		{100, 0.05},
+		{1000, 0.5},
+		{100000, 0.9},
+		{5, 1},
+		{5, 0},
+	}
+
+	rng := rand.New(rand.NewSource(1))
+	for _, tt := range tests {
+		const draws = 20000
+		var sum, squares float64
+		for i := 0; i < draws; i++ {
+			x := binomial(rng, tt.n, tt.p)
+			if x < 0 || x > tt.n {
+				t.Fatalf("binomial(%d, %v) = %d, out of range", tt.n, tt.p, x)
+			}
+			sum += float64(x)
+			squares += float64(x) * float64(x)
+		}
+
+		mean := sum / draws
+		variance := squares/draws - mean*mean
+		wantMean := float64(tt.n) * tt.p
+		wantVariance := wantMean * (1 - tt.p)
+		if math.Abs(mean-wantMean) > 0.05*math.Sqrt(wantVariance)+1e-9 {
+			t.Errorf("binomial(%d, %v) mean = %v, want %v", tt.n, tt.p, mean, wantMean)
+		}
+		if math.Abs(variance-wantVariance) > 0.05*wantVariance+1e-9 {
+			t.Errorf("binomial(%d, %v) variance = %v, want %v", tt.n, tt.p, variance, wantVariance)
+		}
+	}
+}
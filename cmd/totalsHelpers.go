@@ -0,0 +1,217 @@
+package cmd
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/spf13/viper"
+)
+
+// runTotals counts the results of a run as they complete, so a run holds its
+// totals, the rows not yet answered by every model and the results the report
+// details, rather than every result. All results are in the result log.
+type runTotals struct {
+	models  map[string]*modelTotals
+	llms    int
+	pending map[int]map[string]bool
+	pairs   map[[2]string]*modelComparison
+
+	count    int
+	detailed []GlobalResult
+	omitted  int
+}
+
+// modelTotals are the running counts of one model's results.
+type modelTotals struct {
+	summary   modelSummary
+	agreement float64
+	scoreSum  float64
+	scored    int
+	outcomes  outcomeCounts
+}
+
+// outcomeCounts counts a model's results by outcome, which is all that its
+// metrics depend on.
+type outcomeCounts map[outcome]int
+
+func newRunTotals(llms int) *runTotals {
+	return &runTotals{
+		models:  make(map[string]*modelTotals),
+		llms:    llms,
+		pending: make(map[int]map[string]bool),
+		pairs:   make(map[[2]string]*modelComparison),
+	}
+}
+
+func getReportDetails() int {
+	if !viper.IsSet("reportDetails") {
+		return 1000
+	}
+	return viper.GetInt("reportDetails")
+}
+
+// add counts a result. Results the report details, those that are not
+// correct, graded or flaky, are kept up to reportDetails of them.
+func (t *runTotals) add(result GlobalResult) {
+	llm := result.GetLLM()
+	m, ok := t.models[llm]
+	if !ok {
+		m = &modelTotals{summary: modelSummary{LLM: llm}, outcomes: make(outcomeCounts)}
+		t.models[llm] = m
+	}
+
+	o := newOutcome(result)
+	m.outcomes[o]++
+	m.summary.Total++
+	if o.inconclusive {
+		m.summary.Inconclusive++
+	} else if o.correct() {
+		m.summary.Passed++
+	} else {
+		m.summary.Failed++
+	}
+
+	m.agreement += sampleAgreement(result.GetSamples())
+	if isFlaky(result.GetSamples()) {
+		m.summary.Flaky++
+	}
+	if grade := result.GetGrade(); grade != nil && !grade.Inconclusive {
+		m.scoreSum += grade.Score
+		m.scored++
+	}
+
+	if !o.inconclusive && viper.GetBool("verbose") {
+		fmt.Println(t.count, o.expected, result)
+	}
+	t.count++
+
+	t.pair(entryRow(result.GetData()), llm, o.correct())
+
+	if o.correct() && result.GetGrade() == nil && !isFlaky(result.GetSamples()) {
+		return
+	}
+	if len(t.detailed) < getReportDetails() {
+		t.detailed = append(t.detailed, result)
+	} else {
+		t.omitted++
+	}
+}
+
+// pair holds whether each model answered a row correctly until every model
+// has answered it, then counts the row towards the McNemar's test of every
+// pair of models.
+func (t *runTotals) pair(row int, llm string, correct bool) {
+	answers := t.pending[row]
+	if answers == nil {
+		answers = make(map[string]bool)
+		t.pending[row] = answers
+	}
+	answers[llm] = correct
+
+	if len(answers) >= t.llms {
+		t.countPairs(answers)
+		delete(t.pending, row)
+	}
+}
+
+func (t *runTotals) countPairs(answers map[string]bool) {
+	for a, aCorrect := range answers {
+		for b, bCorrect := range answers {
+			if a >= b {
+				continue
+			}
+
+			c := t.comparison(a, b)
+			c.Rows++
+			if aCorrect && !bCorrect {
+				c.AOnly++
+			} else if bCorrect && !aCorrect {
+				c.BOnly++
+			}
+		}
+	}
+}
+
+func (t *runTotals) comparison(a, b string) *modelComparison {
+	c, ok := t.pairs[[2]string{a, b}]
+	if !ok {
+		c = &modelComparison{A: a, B: b}
+		t.pairs[[2]string{a, b}] = c
+	}
+	return c
+}
+
+func (t *runTotals) llmNames() []string {
+	llms := make([]string, 0, len(t.models))
+	for llm := range t.models {
+		llms = append(llms, llm)
+	}
+	sort.Strings(llms)
+	return llms
+}
+
+// summaries are the per-model summaries of the results counted so far.
+func (t *runTotals) summaries() []modelSummary {
+	summaries := make([]modelSummary, 0, len(t.models))
+	for _, llm := range t.llmNames() {
+		m := t.models[llm]
+		summary := m.summary
+		summary.Accuracy = Round((float64(summary.Passed)/float64(summary.Total))*100, 0.05)
+		summary.Stability = Round((m.agreement/float64(summary.Total))*100, 0.05)
+		if multiClass() {
+			summary.Matrix = newLabelMatrix(m.outcomes)
+			summary.Classes = summary.Matrix.classes()
+		} else {
+			summary.Confusion = &confusionMatrix{}
+			for o, n := range m.outcomes {
+				summary.Confusion.add(o, n)
+			}
+		}
+		summary.Metrics = outcomeMetrics(m.outcomes).reported()
+		if m.scored > 0 {
+			mean := m.scoreSum / float64(m.scored)
+			summary.MeanScore = &mean
+		}
+		summary.Intervals = bootstrapIntervals(llm, m.outcomes, getBootstrapIterations())
+		summaries = append(summaries, summary)
+	}
+	return summaries
+}
+
+// meanScore averages the grades of all models, leaving out inconclusive ones.
+// It is nil when no result was graded.
+func (t *runTotals) meanScore() *float64 {
+	var sum float64
+	var scored int
+	for _, m := range t.models {
+		sum += m.scoreSum
+		scored += m.scored
+	}
+	if scored == 0 {
+		return nil
+	}
+
+	mean := sum / float64(scored)
+	return &mean
+}
+
+// comparisons runs a McNemar's test between every pair of models, over the
+// rows both of them answered.
+func (t *runTotals) comparisons() []modelComparison {
+	// rows some model never answered still count for the models that did
+	for row, answers := range t.pending {
+		t.countPairs(answers)
+		delete(t.pending, row)
+	}
+
+	llms := t.llmNames()
+	var comparisons []modelComparison
+	for i := range llms {
+		for j := i + 1; j < len(llms); j++ {
+			c := t.comparison(llms[i], llms[j])
+			c.test()
+			comparisons = append(comparisons, *c)
+		}
+	}
+	return comparisons
+}
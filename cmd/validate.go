@@ -0,0 +1,86 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+func init() {
+	scoreCmd.AddCommand(validateCmd)
+	validateCmd.AddCommand(validatePseudoCmd)
+
+	validateCmd.PersistentFlags().StringP("dataFile", "d", "", "directory location for csv or jsonl data set, optionally gzipped.")
+	validateCmd.PersistentFlags().String("dataFormat", "", "format of the data set: csv or jsonl. (default is by file extension)")
+	validateCmd.PersistentFlags().String("labelColumn", "", "labels are in this dataset column instead of passed.")
+	validateCmd.PersistentFlags().StringSliceP("llms", "l", llms, "llms whose context windows the prompts are checked against.")
+	validateCmd.PersistentFlags().StringArray("param", nil, "override a generation parameter for every model, e.g. maxTokens=1024. (repeatable)")
+	validateCmd.PersistentFlags().StringP("prompt", "p", "", "prompt to check against the data set.")
+	validateCmd.PersistentFlags().StringP("promptFile", "f", "", "directory location of a prompt file to check against the data set.")
+	validateCmd.PersistentFlags().StringP("systemPrompt", "s", "", "system prompt counted towards the prompt tokens.")
+}
+
+var (
+	validateCmd = &cobra.Command{
+		Use:   "validate",
+		Short: "Check a data set and prompt without calling any model.",
+		Long: "Load a data set, and the prompt when one is given, the way run would and report rows with missing or invalid columns, " +
+			"the label distribution, duplicate rows, template fields missing from the data and estimated prompt tokens " +
+			"against the context window of each model. Exits with 1 when a run would fail or prompts would not fit.",
+		Args: cobra.NoArgs,
+		Run:  onValidate,
+	}
+
+	validatePseudoCmd = &cobra.Command{
+		Use:   "pseudo",
+		Short: "Check a pseudocode data set and prompt.",
+		Long:  "Check a pseudocode data set, as used by run pseudo, and the prompt without calling any model.",
+		Args:  cobra.NoArgs,
+		Run:   onValidatePseudo,
+	}
+)
+
+func onValidate(cmd *cobra.Command, args []string) {
+	validate(cmd, false)
+}
+
+func onValidatePseudo(cmd *cobra.Command, args []string) {
+	validate(cmd, true)
+}
+
+func validate(cmd *cobra.Command, pseudo bool) {
+	// bound here rather than in init, where they would take the viper keys
+	// from the run flags of the same names
+	flags := map[string]string{
+		"dataFile":     "dataFile",
+		"dataFormat":   "dataFormat",
+		"labelColumn":  "labelColumn",
+		"llms":         "llms",
+		"params":       "param",
+		"prompt":       "prompt",
+		"promptFile":   "promptFile",
+		"systemPrompt": "systemPrompt",
+	}
+	for key, flag := range flags {
+		viper.BindPFlag(key, cmd.Flags().Lookup(flag))
+	}
+
+	path := viper.GetString("dataFile")
+	if path == "" {
+		cmd.Help()
+		os.Exit(1)
+	}
+
+	// endpoint models are only known once registered, as for run
+	cobra.CheckErr(registerEndpoints())
+
+	report, err := validateDataset(path, pseudo)
+	cobra.CheckErr(err)
+
+	fmt.Print(report)
+	if report.failed() {
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,591 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/spf13/viper"
+)
+
+// contextWindows are the context windows, in tokens, of well-known models by
+// name prefix. The contextWindows section of the config adds to and overrides
+// them, by prefix as well, so my-finetune below also covers my-finetune:v2:
+//
+//	contextWindows:
+//	  llama3: 8192
+//	  my-finetune: 32000
+var contextWindows = map[string]int{
+	"gpt-3.5-turbo":           16385,
+	"gpt-4":                   8192,
+	"gpt-4-32k":               32768,
+	"gpt-4-turbo":             128000,
+	"gpt-4o":                  128000,
+	"claude-instant-1":        100000,
+	"claude-2":                100000,
+	"claude-2.1":              200000,
+	"claude-3":                200000,
+	"llama3":                  8192,
+	"meta-llama/meta-llama-3": 8192,
+	"mistral":                 32768,
+}
+
+// validatedRow is a dataset row that was read into a data entry.
+type validatedRow struct {
+	row   int
+	entry interface{}
+}
+
+// validationReport is what validate found in a dataset and prompt.
+type validationReport struct {
+	path       string
+	format     string
+	rows       int
+	labels     map[string]int
+	problems   []rowProblem
+	duplicates []string
+
+	// template fields missing from rows, by field
+	missing      map[string][]int
+	templateUsed bool
+
+	tokens  []int
+	windows []windowCheck
+}
+
+// rowProblem is a message about a dataset row.
+type rowProblem struct {
+	row     int
+	message string
+}
+
+// windowCheck compares the estimated prompt tokens to one model's context
+// window.
+type windowCheck struct {
+	llm    string
+	window int
+	output int
+	over   []int
+	err    error
+}
+
+// validateDataset reads a dataset and, when given, the prompt without calling
+// any model. Bad rows are reported instead of ending the run.
+func validateDataset(path string, pseudo bool) (*validationReport, error) {
+	report := validationReport{
+		path:    path,
+		format:  dataFormat(path),
+		labels:  make(map[string]int),
+		missing: make(map[string][]int),
+	}
+
+	rows, err := report.readRows(path, pseudo)
+	if err != nil {
+		return nil, err
+	}
+	report.rows += len(rows)
+
+	required := []string{"diffDelta"}
+	if pseudo {
+		required = []string{"external", "patch", "vuln"}
+	}
+	hasPrompt := viper.GetString("prompt") != "" || viper.GetString("promptFile") != ""
+	if hasPrompt {
+		promptOnce.Do(loadPrompt)
+		report.templateUsed = promptTemplate != nil
+	}
+
+	seen := make(map[string]int)
+	for _, r := range rows {
+		fields := entryFields(r.entry)
+		report.labels[expectedLabel(r.entry)]++
+
+		// prompts that are not templates have the data appended to them
+		if !report.templateUsed {
+			for _, name := range required {
+				if strings.TrimSpace(fields[name]) == "" {
+					report.problem(r.row, "%s is missing or empty", name)
+				}
+			}
+		}
+
+		key := duplicateKey(fields)
+		if first, ok := seen[key]; ok {
+			report.duplicates = append(report.duplicates, fmt.Sprintf("row %d duplicates row %d", r.row, first))
+		} else {
+			seen[key] = r.row
+		}
+
+		if hasPrompt {
+			report.checkPrompt(r, pseudo)
+		}
+	}
+
+	if hasPrompt {
+		report.checkWindows()
+	}
+
+	return &report, nil
+}
+
+// readRows reads every row it can, noting the ones it cannot.
+func (r *validationReport) readRows(path string, pseudo bool) ([]validatedRow, error) {
+	schema, err := loadSchema(path)
+	if err != nil {
+		return nil, err
+	}
+
+	switch {
+	case schema == nil && r.format == "csv":
+		return r.readPositionalCSV(path, pseudo)
+	case r.format == "csv":
+		return r.readSchemaCSV(path, schema, pseudo)
+	case r.format == "jsonl":
+		return r.readJSONL(path, pseudo)
+	default:
+		return nil, fmt.Errorf("unknown --dataFormat %q", r.format)
+	}
+}
+
+// readPositionalCSV reads a csv without a schema, where columns are read by
+// position as in eachDataEntry and eachPseudoDataEntry.
+func (r *validationReport) readPositionalCSV(path string, pseudo bool) ([]validatedRow, error) {
+	f, err := openDataset(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	reader := csv.NewReader(f)
+	reader.FieldsPerRecord = -1
+
+	first, columns, label := "passed", 2, 0
+	if pseudo {
+		first, columns, label = "lesson", 6, 3
+	}
+
+	var rows []validatedRow
+	var header []string
+	for i := 0; ; i++ {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		var parseErr *csv.ParseError
+		if errors.As(err, &parseErr) {
+			r.rows++
+			r.problem(i, "%v", parseErr)
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+
+		// matched exactly, as run does
+		if record[0] == first {
+			header = record
+			continue
+		}
+
+		if len(record) < columns {
+			r.rows++
+			r.problem(i, "has %d columns, expected at least %d", len(record), columns)
+			continue
+		}
+		if header != nil && len(record) != len(header) {
+			r.problem(i, "has %d columns, the header has %d", len(record), len(header))
+		}
+		r.checkPassed(i, record[label], true)
+
+		if !pseudo {
+			if _, err := Base64Decode(record[1]); err != nil {
+				r.rows++
+				r.problem(i, "diffDelta is not valid base64: %v", err)
+				continue
+			}
+		}
+
+		var e interface{}
+		if pseudo {
+			var pe PseudoDataEntry
+			pe, err = parsePseudoDataEntry(i, header, record)
+			e = pe
+		} else {
+			var de DataEntry
+			de, err = parseDataEntry(i, header, record)
+			e = de
+		}
+		if err != nil {
+			r.rows++
+			r.problem(i, "%v", err)
+			continue
+		}
+
+		rows = append(rows, validatedRow{row: i, entry: e})
+	}
+
+	return rows, nil
+}
+
+// readSchemaCSV reads a csv by its schema, as scanSchemaCSV does in a run.
+func (r *validationReport) readSchemaCSV(path string, schema *datasetSchema, pseudo bool) ([]validatedRow, error) {
+	f, err := openDataset(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	reader, swap, err := newSchemaCSVReader(f, schema)
+	if err != nil {
+		return nil, err
+	}
+	reader.FieldsPerRecord = -1
+
+	var rows []validatedRow
+	var columns *schemaColumns
+	for i := 0; ; i++ {
+		values, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		var parseErr *csv.ParseError
+		if errors.As(err, &parseErr) {
+			r.rows++
+			r.problem(i, "%v", parseErr)
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+
+		if columns == nil {
+			// a header missing the schema's columns leaves nothing to check
+			if columns, err = newSchemaColumns(path, schema, values, swap); err != nil {
+				return nil, err
+			}
+			continue
+		}
+
+		if len(values) != len(columns.header) {
+			r.problem(i, "has %d columns, the header has %d", len(values), len(columns.header))
+		}
+		record, err := columns.record(i, values)
+		if err != nil {
+			r.rows++
+			r.problems = append(r.problems, rowProblem{row: i, message: err.Error()})
+			continue
+		}
+
+		if row, ok := r.newEntry(record, pseudo); ok {
+			rows = append(rows, row)
+		}
+	}
+
+	return rows, nil
+}
+
+// readJSONL reads a jsonl dataset line by line.
+func (r *validationReport) readJSONL(path string, pseudo bool) ([]validatedRow, error) {
+	f, err := openDataset(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var rows []validatedRow
+	scanner := newJSONLScanner(f)
+	for line := 1; scanner.Scan(); line++ {
+		text := bytes.TrimSpace(scanner.Bytes())
+		if len(text) == 0 {
+			continue
+		}
+
+		fields, err := parseJSONRecord(text)
+		if err != nil {
+			r.rows++
+			r.problem(line, "%v", err)
+			continue
+		}
+
+		if row, ok := r.newEntry(datasetRecord{row: line, fields: fields}, pseudo); ok {
+			rows = append(rows, row)
+		}
+	}
+
+	return rows, scanner.Err()
+}
+
+// newEntry builds the data entry of a named record.
+func (r *validationReport) newEntry(record datasetRecord, pseudo bool) (validatedRow, bool) {
+	passed, ok := record.fields["passed"]
+	r.checkPassed(record.row, passed, ok)
+
+	var e interface{}
+	var err error
+	if pseudo {
+		e, err = newPseudoDataEntry(record)
+	} else {
+		e, err = newDataEntry(record)
+	}
+	if err != nil {
+		r.rows++
+		r.problem(record.row, "%v", err)
+		return validatedRow{}, false
+	}
+
+	return validatedRow{row: record.row, entry: e}, true
+}
+
+// checkPassed notes a passed value that is neither true nor false, which a run
+// would silently read as false. With --labelColumn, passed is not used.
+func (r *validationReport) checkPassed(row int, value string, ok bool) {
+	if viper.GetString("labelColumn") != "" {
+		return
+	}
+	if !ok {
+		r.problem(row, "has no passed field")
+		return
+	}
+	switch strings.ToLower(strings.TrimSpace(value)) {
+	case "true", "false":
+	default:
+		r.problem(row, "passed is %q, expected true or false", value)
+	}
+}
+
+// checkPrompt renders the prompt of a row and estimates its tokens.
+func (r *validationReport) checkPrompt(row validatedRow, pseudo bool) {
+	fields := entryFields(row.entry)
+
+	if promptTemplate != nil {
+		missing := false
+		for _, field := range templateFields(promptTemplate) {
+			if _, ok := fields[field]; !ok {
+				r.missing[field] = append(r.missing[field], row.row)
+				missing = true
+			}
+		}
+		if missing {
+			return
+		}
+	}
+
+	appendedData := fields["diffDelta"]
+	if pseudo {
+		appendedData = pseudoPrompt(row.entry.(PseudoDataEntry))
+	}
+	prompt, err := renderPrompt(row.entry, appendedData)
+	if err != nil {
+		r.problem(row.row, "prompt: %v", err)
+		return
+	}
+
+	r.tokens = append(r.tokens, estimateTokens(promptTokenText(prompt)))
+}
+
+// checkWindows compares the rendered prompts to the context window of every
+// --llms model, less the tokens it may generate.
+func (r *validationReport) checkWindows() {
+	if len(r.tokens) == 0 {
+		return
+	}
+	for _, llm := range viper.GetStringSlice("llms") {
+		check := windowCheck{llm: llm}
+
+		_, model, err := resolveProvider(llm)
+		if err == nil {
+			err = initModelParams(llm, model)
+		}
+		if err != nil {
+			check.err = err
+			r.windows = append(r.windows, check)
+			continue
+		}
+
+		check.window = contextWindow(llm, model)
+		if params, ok := modelParams[llm]; ok && params.MaxTokens != nil {
+			check.output = *params.MaxTokens
+		}
+		if check.window > 0 {
+			for i, tokens := range r.tokens {
+				if tokens+check.output > check.window {
+					check.over = append(check.over, i)
+				}
+			}
+		}
+		r.windows = append(r.windows, check)
+	}
+}
+
+func (r *validationReport) problem(row int, format string, a ...interface{}) {
+	message := fmt.Sprintf("row %d: ", row) + fmt.Sprintf(format, a...)
+	r.problems = append(r.problems, rowProblem{row: row, message: message})
+}
+
+// failed is whether a run of the dataset would break or mislead: bad rows,
+// template fields the data lacks or prompts too long for a model. Duplicate
+// rows are only a warning.
+func (r *validationReport) failed() bool {
+	if len(r.problems) > 0 || len(r.missing) > 0 {
+		return true
+	}
+	for _, w := range r.windows {
+		if w.err != nil || len(w.over) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *validationReport) String() string {
+	var sb strings.Builder
+
+	valid := 0
+	for _, count := range r.labels {
+		valid += count
+	}
+	fmt.Fprintf(&sb, "\nDataset %s (%s): %d rows, %d valid\n", r.path, r.format, r.rows, valid)
+
+	fmt.Fprint(&sb, "\nLabel distribution:\n\n")
+	labels := make([]string, 0, len(r.labels))
+	for label := range r.labels {
+		labels = append(labels, label)
+	}
+	sort.Strings(labels)
+	for _, label := range labels {
+		name := label
+		if name == "" {
+			name = "(empty)"
+		}
+		fmt.Fprintf(&sb, "%s: %d (%.2f%%)\n", name, r.labels[label], 100*ratio(float64(r.labels[label]), float64(valid)))
+	}
+
+	if len(r.problems) > 0 {
+		fmt.Fprintf(&sb, "\nRow problems (%d):\n\n", len(r.problems))
+		sort.SliceStable(r.problems, func(i, j int) bool { return r.problems[i].row < r.problems[j].row })
+		for _, problem := range r.problems {
+			fmt.Fprintln(&sb, problem.message)
+		}
+	}
+
+	if len(r.duplicates) > 0 {
+		fmt.Fprintf(&sb, "\nDuplicate rows (%d):\n\n", len(r.duplicates))
+		for _, duplicate := range r.duplicates {
+			fmt.Fprintln(&sb, duplicate)
+		}
+	}
+
+	if len(r.missing) > 0 {
+		fmt.Fprint(&sb, "\nTemplate fields missing from the dataset:\n\n")
+		fields := make([]string, 0, len(r.missing))
+		for field := range r.missing {
+			fields = append(fields, field)
+		}
+		sort.Strings(fields)
+		for _, field := range fields {
+			fmt.Fprintf(&sb, "{{.%s}}: missing from %d rows, e.g. row %d\n", field, len(r.missing[field]), r.missing[field][0])
+		}
+	}
+
+	if len(r.tokens) > 0 {
+		sorted := append([]int{}, r.tokens...)
+		sort.Ints(sorted)
+		total := 0
+		for _, tokens := range sorted {
+			total += tokens
+		}
+		fmt.Fprintf(&sb, "\nEstimated prompt tokens (about 4 characters each) over %d rendered prompts:\n\n", len(r.tokens))
+		fmt.Fprintf(&sb, "min %d, mean %.0f, max %d\n", sorted[0], float64(total)/float64(len(sorted)), sorted[len(sorted)-1])
+	}
+
+	if len(r.windows) > 0 {
+		fmt.Fprint(&sb, "\nContext windows:\n\n")
+		for _, w := range r.windows {
+			switch {
+			case w.err != nil:
+				fmt.Fprintf(&sb, "%s: %v\n", w.llm, w.err)
+			case w.window == 0:
+				fmt.Fprintf(&sb, "%s: unknown context window, set contextWindows in the config to check it\n", w.llm)
+			case len(w.over) > 0:
+				fmt.Fprintf(&sb, "%s: %d of %d prompts exceed %d tokens", w.llm, len(w.over), len(r.tokens), w.window)
+				if w.output > 0 {
+					fmt.Fprintf(&sb, " with %d for the response", w.output)
+				}
+				fmt.Fprintln(&sb)
+			default:
+				fmt.Fprintf(&sb, "%s: every prompt fits in %d tokens\n", w.llm, w.window)
+			}
+		}
+	}
+
+	return sb.String()
+}
+
+// duplicateKey identifies a row by its fields other than id.
+func duplicateKey(fields map[string]string) string {
+	names := make([]string, 0, len(fields))
+	for name := range fields {
+		if name != "id" {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	var sb strings.Builder
+	for _, name := range names {
+		sb.WriteString(name + "\x00" + fields[name] + "\x00")
+	}
+	return sb.String()
+}
+
+// promptTokenText is everything sent for a prompt: the system message, the
+// conversation turns and the rendered prompt.
+func promptTokenText(prompt string) string {
+	system := viper.GetString("systemPrompt")
+	if system == "" {
+		system = promptSystem
+	}
+
+	parts := []string{system}
+	for _, message := range promptMessages {
+		parts = append(parts, message.Content)
+	}
+	return strings.Join(append(parts, prompt), "\n")
+}
+
+// estimateTokens approximates the tokens of text at four characters each,
+// which is close for English and code with the common tokenizers.
+func estimateTokens(text string) int {
+	return (len([]rune(text)) + 3) / 4
+}
+
+// contextWindow is the context window of the longest prefix of the llm or its
+// model name among the built-in windows and those of the config, which take
+// precedence. It is 0 when unknown.
+func contextWindow(llm, model string) int {
+	windows := make(map[string]int, len(contextWindows))
+	for prefix, tokens := range contextWindows {
+		windows[prefix] = tokens
+	}
+	for prefix, value := range viper.GetStringMapString("contextWindows") {
+		if tokens, err := strconv.Atoi(value); err == nil {
+			windows[strings.ToLower(prefix)] = tokens
+		}
+	}
+
+	window, longest := 0, -1
+	for _, name := range []string{llm, model} {
+		name = strings.ToLower(name)
+		for prefix, tokens := range windows {
+			if strings.HasPrefix(name, prefix) && len(prefix) > longest {
+				window, longest = tokens, len(prefix)
+			}
+		}
+	}
+	return window
+}
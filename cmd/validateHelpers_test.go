@@ -0,0 +1,201 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/spf13/viper"
+)
+
+// validateFixture writes a dataset to a temp file and validates it with the
+// given prompt, if any.
+func validateFixture(t *testing.T, name, content, prompt string, pseudo bool) *validationReport {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	viper.Reset()
+	t.Cleanup(viper.Reset)
+	viper.Set("prompt", prompt)
+
+	promptOnce = sync.Once{}
+	promptText, promptTemplate, promptSystem, promptMessages = "", nil, "", nil
+	t.Cleanup(func() {
+		promptOnce = sync.Once{}
+		promptText, promptTemplate, promptSystem, promptMessages = "", nil, "", nil
+	})
+
+	report, err := validateDataset(path, pseudo)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return report
+}
+
+func problemMessages(r *validationReport) []string {
+	var messages []string
+	for _, problem := range r.problems {
+		messages = append(messages, problem.message)
+	}
+	return messages
+}
+
+func TestValidateDataset(t *testing.T) {
+	tests := []struct {
+		name       string
+		file       string
+		content    string
+		prompt     string
+		pseudo     bool
+		rows       int
+		problems   []string
+		duplicates []string
+		missing    map[string][]int
+	}{
+		{
+			name:    "valid",
+			file:    "data.csv",
+			content: "passed,diffDelta\ntrue,ZGlmZg==\nfalse,b3RoZXI=\n",
+			rows:    2,
+		},
+		{
+			name:     "bad base64",
+			file:     "data.csv",
+			content:  "passed,diffDelta\ntrue,not base64!\nfalse,ZGlmZg==\n",
+			rows:     2,
+			problems: []string{"row 1: diffDelta is not valid base64: illegal base64 data at input byte 3"},
+		},
+		{
+			name:     "short rows",
+			file:     "data.csv",
+			content:  "passed,diffDelta\ntrue\nfalse,ZGlmZg==\n",
+			rows:     2,
+			problems: []string{"row 1: has 1 columns, expected at least 2"},
+		},
+		{
+			name:     "short pseudo rows",
+			file:     "pseudo.csv",
+			content:  "lesson,external,patch,passed,reason,vuln\nsql,code,patch\nsql,code,patch,true,why,sqli\n",
+			pseudo:   true,
+			rows:     2,
+			problems: []string{"row 1: has 3 columns, expected at least 6"},
+		},
+		{
+			name:     "unknown passed",
+			file:     "data.csv",
+			content:  "passed,diffDelta\nmaybe,ZGlmZg==\n",
+			rows:     1,
+			problems: []string{`row 1: passed is "maybe", expected true or false`},
+		},
+		{
+			name:       "duplicates",
+			file:       "data.csv",
+			content:    "passed,diffDelta\ntrue,ZGlmZg==\nfalse,b3RoZXI=\ntrue,ZGlmZg==\n",
+			rows:       3,
+			duplicates: []string{"row 3 duplicates row 1"},
+		},
+		{
+			name:       "jsonl duplicates ignore id",
+			file:       "data.jsonl",
+			content:    `{"id": 1, "passed": true, "diffDelta": "diff"}` + "\n" + `{"id": 2, "passed": true, "diffDelta": "diff"}` + "\n",
+			rows:       2,
+			duplicates: []string{"row 2 duplicates row 1"},
+		},
+		{
+			name:     "jsonl bad line",
+			file:     "data.jsonl",
+			content:  `{"passed": true, "diffDelta": "diff"}` + "\n" + `{"passed": tru` + "\n",
+			rows:     2,
+			problems: []string{"row 2: "},
+		},
+		{
+			name:    "missing template fields",
+			file:    "data.jsonl",
+			content: `{"passed": true, "diffDelta": "a", "lang": "go"}` + "\n" + `{"passed": false, "diffDelta": "b"}` + "\n" + `{"passed": true, "diffDelta": "c"}` + "\n",
+			prompt:  "Review this {{.lang}} diff:\n{{.diffDelta}}",
+			rows:    3,
+			missing: map[string][]int{"lang": {2, 3}},
+		},
+		{
+			name:     "missing appended data",
+			file:     "data.csv",
+			content:  "passed,diffDelta\ntrue,\n",
+			prompt:   "Is this diff safe?",
+			rows:     1,
+			problems: []string{"row 1: diffDelta is missing or empty"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			report := validateFixture(t, tt.file, tt.content, tt.prompt, tt.pseudo)
+
+			if report.rows != tt.rows {
+				t.Errorf("rows = %d, want %d", report.rows, tt.rows)
+			}
+
+			problems := problemMessages(report)
+			if len(problems) != len(tt.problems) {
+				t.Errorf("problems = %q, want %q", problems, tt.problems)
+			} else {
+				for i, want := range tt.problems {
+					if !strings.HasPrefix(problems[i], want) {
+						t.Errorf("problem %d = %q, want %q", i, problems[i], want)
+					}
+				}
+			}
+
+			if !reflect.DeepEqual(report.duplicates, tt.duplicates) {
+				t.Errorf("duplicates = %q, want %q", report.duplicates, tt.duplicates)
+			}
+
+			missing := tt.missing
+			if missing == nil {
+				missing = map[string][]int{}
+			}
+			if !reflect.DeepEqual(report.missing, missing) {
+				t.Errorf("missing = %v, want %v", report.missing, missing)
+			}
+
+			// duplicates alone do not fail validation
+			if failed := len(tt.problems) > 0 || len(tt.missing) > 0; report.failed() != failed {
+				t.Errorf("failed() = %v, want %v", report.failed(), failed)
+			}
+		})
+	}
+}
+
+func TestContextWindow(t *testing.T) {
+	viper.Reset()
+	defer viper.Reset()
+	viper.Set("contextWindows", map[string]interface{}{
+		"llama3":        4096,
+		"ollama:llama3": 16000,
+		"my-finetune":   32000,
+	})
+
+	tests := []struct {
+		llm, model string
+		want       int
+	}{
+		{"gpt-4-0613", "gpt-4-0613", 8192},
+		{"gpt-4-turbo-preview", "gpt-4-turbo-preview", 128000},
+		{"llamacpp:llama3:8b", "llama3:8b", 4096},
+		{"ollama:llama3:8b", "llama3:8b", 16000},
+		{"gateway:my-finetune:v2", "my-finetune:v2", 32000},
+		{"mock:always-true", "mock:always-true", 0},
+	}
+
+	for _, tt := range tests {
+		if got := contextWindow(tt.llm, tt.model); got != tt.want {
+			t.Errorf("contextWindow(%q, %q) = %d, want %d", tt.llm, tt.model, got, tt.want)
+		}
+	}
+}
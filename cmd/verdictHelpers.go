@@ -0,0 +1,314 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+var (
+	defaultTrueValues  = []string{"true", "yes", "pass", "passed"}
+	defaultFalseValues = []string{"false", "no", "fail", "failed"}
+
+	verdictNoise = regexp.MustCompile("[*_`\"'.,!:;()\\[\\]]")
+
+	verdictExtractor *VerdictExtractor
+)
+
+// VerdictExtractor turns a raw LLM response into a verdict label. It is
+// configured by the verdict section of the config:
+//
+//	exact       the whole response must be a label
+//	normalized  like exact, ignoring case, whitespace, markdown and punctuation (default)
+//	lastLine    the last label on the last non-empty line
+//	regex       the "verdict" named group, or first capture group, of pattern
+//	json        the field at path (dot separated) of the JSON object in the response
+//	xml         the content of the last <tag>...</tag> element
+//	structured  like json, but also asks the provider for native JSON output
+//
+// By default the labels are "true" and "false", answered with any of
+// verdict.trueValues or verdict.falseValues. With --labelColumn they are
+// verdict.labels instead, or any answer at all if no labels are listed.
+//
+// The model's rationale is whatever remains of the response once the verdict
+// is removed, unless verdict.rationaleTag or verdict.rationalePath point at it.
+type VerdictExtractor struct {
+	kind    string
+	pattern *regexp.Regexp
+	path    []string
+	tag     *regexp.Regexp
+
+	// labels maps every accepted answer to its label; nil accepts any answer
+	labels map[string]string
+
+	rationaleTag  *regexp.Regexp
+	rationalePath []string
+}
+
+func initVerdictExtractor() {
+	extractor, err := newVerdictExtractor()
+	cobra.CheckErr(err)
+	verdictExtractor = extractor
+}
+
+func newVerdictExtractor() (*VerdictExtractor, error) {
+	v := VerdictExtractor{kind: viper.GetString("verdict.type")}
+	if v.kind == "" {
+		v.kind = "normalized"
+	}
+
+	if !multiClass() {
+		v.labels = make(map[string]string)
+		for _, value := range verdictValues("verdict.trueValues", defaultTrueValues) {
+			v.labels[value] = "true"
+		}
+		for _, value := range verdictValues("verdict.falseValues", defaultFalseValues) {
+			v.labels[value] = "false"
+		}
+	} else if labels := viper.GetStringSlice("verdict.labels"); len(labels) > 0 {
+		v.labels = make(map[string]string)
+		for _, label := range labels {
+			v.labels[normalizeVerdict(label)] = normalizeVerdict(label)
+		}
+	}
+
+	switch v.kind {
+	case "exact", "normalized", "lastLine":
+	case "regex":
+		pattern, err := regexp.Compile(viper.GetString("verdict.pattern"))
+		if err != nil {
+			return nil, fmt.Errorf("invalid verdict.pattern: %w", err)
+		}
+		if pattern.NumSubexp() == 0 {
+			return nil, fmt.Errorf("verdict.pattern needs a capture group holding the verdict")
+		}
+		v.pattern = pattern
+	case "json", "structured":
+		if path := viper.GetString("verdict.path"); path != "" {
+			v.path = strings.Split(path, ".")
+		}
+	case "xml":
+		tag := viper.GetString("verdict.tag")
+		if tag == "" {
+			return nil, fmt.Errorf("verdict.type xml needs a verdict.tag")
+		}
+		v.tag = xmlTagPattern(tag)
+	default:
+		return nil, fmt.Errorf("unknown verdict.type %q", v.kind)
+	}
+
+	if tag := viper.GetString("verdict.rationaleTag"); tag != "" {
+		v.rationaleTag = xmlTagPattern(tag)
+	}
+	if path := viper.GetString("verdict.rationalePath"); path != "" {
+		v.rationalePath = strings.Split(path, ".")
+	}
+
+	return &v, nil
+}
+
+func verdictValues(key string, defaults []string) []string {
+	values := viper.GetStringSlice(key)
+	if len(values) == 0 {
+		values = defaults
+	}
+
+	for i, value := range values {
+		values[i] = strings.ToLower(value)
+	}
+	return values
+}
+
+// multiClass reports whether results are graded against a label column
+// instead of the boolean passed column.
+func multiClass() bool {
+	return viper.GetString("labelColumn") != ""
+}
+
+func xmlTagPattern(tag string) *regexp.Regexp {
+	return regexp.MustCompile(`(?s)<` + regexp.QuoteMeta(tag) + `(?:\s[^>]*)?>(.*?)</` + regexp.QuoteMeta(tag) + `>`)
+}
+
+// ResponseFormat is the output format providers are asked for, if any.
+func (v *VerdictExtractor) ResponseFormat() string {
+	if v.kind == "structured" {
+		return "json"
+	}
+	return ""
+}
+
+// Extract returns the verdict label and whether one could be found.
+func (v *VerdictExtractor) Extract(response string) (string, bool) {
+	switch v.kind {
+	case "exact":
+		return v.match(strings.ToLower(strings.TrimSpace(response)))
+	case "normalized":
+		return v.match(normalizeVerdict(response))
+	case "lastLine":
+		return v.lastLine(response)
+	case "regex":
+		return v.regex(response)
+	case "json", "structured":
+		return v.json(response)
+	case "xml":
+		matches := v.tag.FindAllStringSubmatch(response, -1)
+		if len(matches) == 0 {
+			return "", false
+		}
+		return v.match(normalizeVerdict(matches[len(matches)-1][1]))
+	}
+	return "", false
+}
+
+// Rationale returns the reasoning part of a response. Inconclusive responses
+// are returned whole.
+func (v *VerdictExtractor) Rationale(response string) string {
+	if v.rationaleTag != nil {
+		if matches := v.rationaleTag.FindAllStringSubmatch(response, -1); len(matches) > 0 {
+			return strings.TrimSpace(matches[len(matches)-1][1])
+		}
+	}
+	if v.rationalePath != nil {
+		if value, ok := jsonPath(response, v.rationalePath); ok {
+			if text, ok := value.(string); ok {
+				return strings.TrimSpace(text)
+			}
+		}
+	}
+
+	if _, ok := v.Extract(response); !ok {
+		return strings.TrimSpace(response)
+	}
+
+	switch v.kind {
+	case "lastLine":
+		lines := strings.Split(strings.TrimSpace(response), "\n")
+		return strings.TrimSpace(strings.Join(lines[:len(lines)-1], "\n"))
+	case "regex":
+		loc := v.pattern.FindStringIndex(response)
+		return strings.TrimSpace(response[:loc[0]] + response[loc[1]:])
+	case "xml":
+		return strings.TrimSpace(v.tag.ReplaceAllString(response, ""))
+	case "json", "structured":
+		// look for a reasoning field next to the verdict field
+		var parent []string
+		if len(v.path) > 0 {
+			parent = v.path[:len(v.path)-1]
+		}
+		for _, key := range []string{"rationale", "reason", "reasoning", "explanation"} {
+			path := append(append([]string{}, parent...), key)
+			if value, ok := jsonPath(response, path); ok {
+				if text, ok := value.(string); ok {
+					return strings.TrimSpace(text)
+				}
+			}
+		}
+	}
+
+	return ""
+}
+
+func (v *VerdictExtractor) match(value string) (string, bool) {
+	if v.labels == nil {
+		return value, value != ""
+	}
+	label, ok := v.labels[value]
+	return label, ok
+}
+
+func (v *VerdictExtractor) lastLine(response string) (string, bool) {
+	lines := strings.Split(strings.TrimSpace(response), "\n")
+	line := lines[len(lines)-1]
+
+	// labels may span several words, so try the whole line first
+	if label, ok := v.match(normalizeVerdict(line)); ok || v.labels == nil {
+		return label, ok
+	}
+
+	words := strings.Fields(verdictNoise.ReplaceAllString(line, " "))
+	for i := len(words) - 1; i >= 0; i-- {
+		if label, ok := v.match(strings.ToLower(words[i])); ok {
+			return label, true
+		}
+	}
+	return "", false
+}
+
+func (v *VerdictExtractor) regex(response string) (string, bool) {
+	match := v.pattern.FindStringSubmatch(response)
+	if match == nil {
+		return "", false
+	}
+
+	group := 1
+	if i := v.pattern.SubexpIndex("verdict"); i > 0 {
+		group = i
+	}
+	return v.match(normalizeVerdict(match[group]))
+}
+
+func (v *VerdictExtractor) json(response string) (string, bool) {
+	value, ok := jsonPath(response, v.path)
+	if !ok {
+		return "", false
+	}
+
+	switch t := value.(type) {
+	case bool:
+		if !multiClass() {
+			return strconv.FormatBool(t), true
+		}
+		return v.match(strconv.FormatBool(t))
+	case string:
+		return v.match(normalizeVerdict(t))
+	case float64:
+		return v.match(strconv.FormatFloat(t, 'f', -1, 64))
+	}
+	return "", false
+}
+
+// jsonPath decodes the JSON document embedded in a response, ignoring any
+// surrounding prose or code fences, and walks a dot separated path into it.
+func jsonPath(response string, path []string) (interface{}, bool) {
+	var doc interface{}
+	if err := json.Unmarshal([]byte(strings.TrimSpace(response)), &doc); err != nil {
+		start := strings.IndexAny(response, "{[")
+		end := strings.LastIndexAny(response, "}]")
+		if start < 0 || end < start {
+			return nil, false
+		}
+		if err := json.Unmarshal([]byte(response[start:end+1]), &doc); err != nil {
+			return nil, false
+		}
+	}
+
+	for _, key := range path {
+		switch node := doc.(type) {
+		case map[string]interface{}:
+			value, ok := node[key]
+			if !ok {
+				return nil, false
+			}
+			doc = value
+		case []interface{}:
+			i, err := strconv.Atoi(key)
+			if err != nil || i < 0 || i >= len(node) {
+				return nil, false
+			}
+			doc = node[i]
+		default:
+			return nil, false
+		}
+	}
+
+	return doc, true
+}
+
+func normalizeVerdict(value string) string {
+	return strings.ToLower(strings.TrimSpace(verdictNoise.ReplaceAllString(value, "")))
+}
@@ -0,0 +1,82 @@
+package cmd
+
+import (
+	"testing"
+
+	"github.com/spf13/viper"
+)
+
+func TestVerdictExtract(t *testing.T) {
+	tests := []struct {
+		name     string
+		config   map[string]interface{}
+		response string
+		want     string
+		ok       bool
+	}{
+		{"normalized markdown", nil, "**True.**", "true", true},
+		{"normalized synonym", nil, " Yes ", "true", true},
+		{"normalized unknown", nil, "maybe", "", false},
+		{"exact", map[string]interface{}{"verdict.type": "exact"}, " FAIL\n", "false", true},
+		{"exact punctuation", map[string]interface{}{"verdict.type": "exact"}, "false.", "", false},
+		{"last line", map[string]interface{}{"verdict.type": "lastLine"}, "The diff drops a check.\nVerdict: **false**", "false", true},
+		{"last line last word", map[string]interface{}{"verdict.type": "lastLine"}, "Looks fine.\nI would say yes, it passes", "true", true},
+		{"last line only", map[string]interface{}{"verdict.type": "lastLine"}, "true\nno idea", "false", true},
+		{"regex", map[string]interface{}{"verdict.type": "regex", "verdict.pattern": `(?i)verdict:\s*(\w+)`}, "Verdict: PASS", "true", true},
+		{"regex named group", map[string]interface{}{"verdict.type": "regex", "verdict.pattern": `(?P<word>\w+) is (?P<verdict>\w+)`}, "it is failed", "false", true},
+		{"regex no match", map[string]interface{}{"verdict.type": "regex", "verdict.pattern": `verdict: (\w+)`}, "true", "", false},
+		{"json path", map[string]interface{}{"verdict.type": "json", "verdict.path": "result.verdict"}, "Sure:\n```json\n{\"result\": {\"verdict\": \"Pass\"}}\n```", "true", true},
+		{"json bool", map[string]interface{}{"verdict.type": "json", "verdict.path": "safe"}, `{"safe": false}`, "false", true},
+		{"json array index", map[string]interface{}{"verdict.type": "json", "verdict.path": "answers.1"}, `{"answers": ["no", "yes"]}`, "true", true},
+		{"json missing", map[string]interface{}{"verdict.type": "json", "verdict.path": "verdict"}, `{"answer": true}`, "", false},
+		{"xml last tag", map[string]interface{}{"verdict.type": "xml", "verdict.tag": "verdict"}, "<verdict>false</verdict> on second thought <verdict>true</verdict>", "true", true},
+		{"multi-class labels", map[string]interface{}{"labelColumn": "severity", "verdict.labels": []string{"low", "high"}}, "High!", "high", true},
+		{"multi-class unlisted", map[string]interface{}{"labelColumn": "severity", "verdict.labels": []string{"low", "high"}}, "medium", "", false},
+		{"multi-class any", map[string]interface{}{"labelColumn": "severity"}, "Medium", "medium", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			viper.Reset()
+			defer viper.Reset()
+			for key, value := range tt.config {
+				viper.Set(key, value)
+			}
+
+			extractor, err := newVerdictExtractor()
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, ok := extractor.Extract(tt.response)
+			if got != tt.want || ok != tt.ok {
+				t.Errorf("Extract(%q) = %q, %v, want %q, %v", tt.response, got, ok, tt.want, tt.ok)
+			}
+		})
+	}
+}
+
+func TestVerdictExtractorConfig(t *testing.T) {
+	tests := []struct {
+		name   string
+		config map[string]interface{}
+	}{
+		{"unknown type", map[string]interface{}{"verdict.type": "fuzzy"}},
+		{"regex without group", map[string]interface{}{"verdict.type": "regex", "verdict.pattern": "verdict"}},
+		{"invalid regex", map[string]interface{}{"verdict.type": "regex", "verdict.pattern": "("}},
+		{"xml without tag", map[string]interface{}{"verdict.type": "xml"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			viper.Reset()
+			defer viper.Reset()
+			for key, value := range tt.config {
+				viper.Set(key, value)
+			}
+
+			if _, err := newVerdictExtractor(); err == nil {
+				t.Error("expected an error")
+			}
+		})
+	}
+}